@@ -2,16 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"math/big"
-	"strings"
+	"os"
 
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
 
 	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
 	"github.com/nimazeighami/flash-liquswap-sync/internal/atomic"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
 )
 
 func init() {
@@ -22,57 +26,84 @@ func main() {
 	log.Println("🚀 Flashbots Atomic Uniswap V2 Operations (Dynamic Gas)")
 	log.Println("====================================================")
 
+	// "flashbots-address" prints the Flashbots reputation address, e.g. to look up its stats
+	args := os.Args[1:]
+	printFlashbotsAddress := len(args) > 0 && args[0] == "flashbots-address"
+	if printFlashbotsAddress {
+		args = args[1:]
+	}
+
 	// Parse configuration
-	config, err := configs.ParseConfig()
+	config, err := configs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatalf("Configuration error: %v", err)
 	}
-
-	// Validate keys
-	if config.EoaPrivateKey == "YOUR_EOA_PRIVATE_KEY" ||
-		config.FlashbotsSignerKey == "YOUR_FLASHBOTS_SIGNER_KEY" {
-		log.Println("❌ Please set your actual private keys!")
-		log.Println("Usage examples:")
-		log.Println("  go run main.go --eoa-key=0x123... --flashbots-key=0x456...")
-		log.Println("  Or set environment variables: EOA_PRIVATE_KEY and FLASHBOTS_SIGNER_KEY")
-		return
+	if config.ConfigFile != "" {
+		log.Printf("📄 Loaded configuration from %s", config.ConfigFile)
 	}
 
 	ctx := context.Background()
 
+	if printFlashbotsAddress {
+		eoaAddress, err := signer.EOAAddress(ctx, config)
+		if err != nil {
+			log.Fatalf("Failed to resolve EOA: %v", err)
+		}
+		flashbotsSigner, err := signer.OpenFlashbots(ctx, config, eoaAddress)
+		if err != nil {
+			log.Fatalf("Failed to load Flashbots signer: %v", err)
+		}
+		fmt.Println(flashbotsSigner.Address().Hex())
+		return
+	}
+
 	// Initialize Ethereum client
 	client, err := ethclient.Dial(config.RpcURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to Ethereum: %v", err)
 	}
 
-	// Load private keys
-	eoaKey, err := crypto.HexToECDSA(strings.TrimPrefix(config.EoaPrivateKey, "0x"))
+	// Refuse to sign anything for a chain other than the selected network
+	chainID, err := client.NetworkID(ctx)
 	if err != nil {
-		log.Fatalf("Invalid EOA private key: %v", err)
+		log.Fatalf("Failed to get chain ID: %v", err)
 	}
+	if err := config.CheckChainID(chainID); err != nil {
+		log.Fatalf("Network mismatch: %v", err)
+	}
+	log.Printf("🌐 Network: %s (chain ID %s)", config.Network, chainID.String())
 
-	flashbotsKey, err := crypto.HexToECDSA(strings.TrimPrefix(config.FlashbotsSignerKey, "0x"))
+	// Load signers
+	eoa, err := signer.ForEOA(ctx, config)
 	if err != nil {
-		log.Fatalf("Invalid Flashbots signer key: %v", err)
+		log.Printf("❌ %v", err)
+		log.Println("Usage examples:")
+		log.Println("  go run ./cmd/atomic_tx_bot --eoa-keystore=keystore/UTC--...")
+		log.Println("  go run ./cmd/atomic_tx_bot --external-signer=$HOME/.clef/clef.ipc")
+		log.Println("  Or set the same keys in config.yaml or the environment; see --help for every option")
+		return
 	}
 
-	eoaAddress := crypto.PubkeyToAddress(eoaKey.PublicKey)
-	log.Printf("✅ EOA Address: %s", eoaAddress.Hex())
-
-	// Get network parameters
-	chainID, err := client.NetworkID(ctx)
+	flashbotsSigner, err := signer.ForFlashbots(ctx, config, eoa.Address())
 	if err != nil {
-		log.Fatalf("Failed to get chain ID: %v", err)
+		log.Fatalf("Failed to load Flashbots signer: %v", err)
 	}
 
-	nonce, err := client.PendingNonceAt(ctx, eoaAddress)
+	eoaAddress := eoa.Address()
+
+	// One relay client for the whole run, sharing the Ethereum connection
+	fb, err := flashbot.NewClient(config, client, flashbotsSigner)
 	if err != nil {
-		log.Fatalf("Failed to get nonce: %v", err)
+		log.Fatalf("Failed to create Flashbots client: %v", err)
 	}
+	log.Printf("✅ EOA Address: %s", eoaAddress.Hex())
+	log.Printf("🔑 Flashbots reputation address: %s", flashbotsSigner.Address().Hex())
 
 	// Calculate dynamic gas parameters
-	gasParams, err := atomic.CalculateDynamicGasParams(ctx, client)
+	gasParams, err := atomic.CalculateDynamicGasParams(ctx, client, config.Gas)
 	if err != nil {
 		log.Fatalf("Failed to calculate gas parameters: %v", err)
 	}
@@ -85,19 +116,53 @@ func main() {
 			atomic.WeiToGwei(gasParams.MaxPriorityFee).Text('f', 2))
 	}
 
-	log.Printf("Chain ID: %s, Nonce: %d", chainID.String(), nonce)
-
 	// Display transaction plan
-	ethFloat := new(big.Float).Quo(new(big.Float).SetInt(config.EthAmount), big.NewFloat(params.Ether))
+	tokens, err := atomic.NewTokenRegistry(client)
+	if err != nil {
+		log.Fatalf("Failed to create token registry: %v", err)
+	}
+	token, err := tokens.Info(ctx, config.TokenAddress)
+	if err != nil {
+		log.Fatalf("Failed to read token metadata: %v", err)
+	}
+
 	log.Printf("📋 Transaction Plan:")
-	log.Printf("   • Swap %s ETH → %s", ethFloat.Text('f', 6), config.TokenAddress.Hex())
-	log.Printf("   • Add liquidity with received tokens + remaining ETH")
+	switch config.Operation {
+	case configs.OPERATION_EXIT:
+		log.Printf("   • Remove all %s/WETH liquidity", token.Symbol)
+		log.Printf("   • Swap returned %s → ETH", token.Symbol)
+	default:
+		if config.PaysWithToken() {
+			inputToken, err := tokens.Info(ctx, config.InputToken)
+			if err != nil {
+				log.Fatalf("Failed to read input token metadata: %v", err)
+			}
+			log.Printf("   • Swap %s → ETH via the best path", inputToken.Format(config.InputAmount))
+		} else {
+			ethFloat := new(big.Float).Quo(new(big.Float).SetInt(config.EthAmount), big.NewFloat(params.Ether))
+			log.Printf("   • Swap %s ETH → %s (%s)", ethFloat.Text('f', 6), token.Symbol, config.TokenAddress.Hex())
+		}
+		log.Printf("   • Add liquidity with received tokens + remaining ETH")
+	}
+	log.Printf("   • DEX: %s", config.Dex)
 	log.Printf("   • Slippage tolerance: %.2f%%", config.SlippageTolerance*100)
+	if config.DryRun {
+		log.Printf("   • Dry run: build and simulate only, nothing is sent")
+	}
 
 	// Execute atomic operations
-	if err := atomic.ExecuteAtomicOperations(ctx, client, config, eoaKey, flashbotsKey, chainID, nonce, gasParams); err != nil {
+	execute := atomic.ExecuteAtomicOperations
+	if config.Operation == configs.OPERATION_EXIT {
+		execute = atomic.ExecuteExitOperations
+	}
+	nonces := atomic.NewNonceManager(client, config.NonceLockDir())
+	if err := execute(ctx, fb, config, eoa, chainID, nonces, gasParams); err != nil {
 		log.Fatalf("Execution failed: %v", err)
 	}
 
+	if config.DryRun {
+		log.Println("🧪 Dry run completed, no bundle was sent")
+		return
+	}
 	log.Println("🎉 Atomic operations completed successfully!")
 }
@@ -0,0 +1,188 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// approve adds the legs that let spender pull amount of token from the EOA under name. Nothing
+// is added when the current allowance already covers amount. Otherwise the allowance is granted
+// with an EIP-2612 permit when config.UsePermit is set and the token supports it, or with an
+// approve preceded by a reset to zero for tokens that refuse to change a non-zero allowance.
+// All of these legs may revert, since the allowance can change before the bundle lands.
+func (b *legBuilder) approve(ctx context.Context, tokens *TokenRegistry, name string, token, spender common.Address, amount *big.Int) error {
+	owner := b.opts().From()
+	allowance, err := tokens.Allowance(ctx, token, owner, spender)
+	if err != nil {
+		return fmt.Errorf("failed to read allowance: %v", err)
+	}
+	info, err := tokens.Info(ctx, token)
+	if err != nil {
+		return err
+	}
+	if allowance.Cmp(amount) >= 0 {
+		log.Printf("Allowance of %s already covers %s, skipping %s", info.Format(allowance), info.Format(amount), name)
+		return nil
+	}
+
+	if b.runner.config.UsePermit {
+		permitted, err := b.permit(ctx, tokens, name, token, spender, amount)
+		if err != nil {
+			return err
+		}
+		if permitted {
+			return nil
+		}
+		log.Printf("⚠️  %s does not support EIP-2612 permits, falling back to approve", info.Symbol)
+	}
+
+	if allowance.Sign() > 0 && requiresZeroReset(ctx, tokens, token, owner, spender, amount) {
+		resetTx, err := createApproveTransaction(ctx, b.runner.fb.Eth(), b.opts(), token, spender, big.NewInt(0), &tokens.erc20ABI)
+		if err != nil {
+			return fmt.Errorf("failed to create allowance reset transaction: %v", err)
+		}
+		log.Printf("Reset %s allowance TX hash: %s (Gas: %d)", info.Symbol, resetTx.Hash().Hex(), resetTx.Gas())
+		b.add(name+"Reset", resetTx, true)
+	}
+
+	approveTx, err := createApproveTransaction(ctx, b.runner.fb.Eth(), b.opts(), token, spender, amount, &tokens.erc20ABI)
+	if err != nil {
+		return fmt.Errorf("failed to create approve transaction: %v", err)
+	}
+	log.Printf("Approve %s TX hash: %s (Gas: %d)", info.Symbol, approveTx.Hash().Hex(), approveTx.Gas())
+	b.add(name, approveTx, true)
+	return nil
+}
+
+// permit adds a leg calling token.permit with a signature of the EOA, reporting false when the
+// token exposes no EIP-2612 nonces or domain separator, or a domain permitDomain cannot rebuild.
+func (b *legBuilder) permit(ctx context.Context, tokens *TokenRegistry, name string, token, spender common.Address, amount *big.Int) (bool, error) {
+	client := b.runner.fb.Eth()
+	opts := b.opts()
+	owner := opts.From()
+
+	values, err := callView(ctx, client, &tokens.erc20ABI, token, "DOMAIN_SEPARATOR")
+	if err != nil {
+		return false, nil
+	}
+	domainSeparator := values[0].([32]byte)
+	values, err = callView(ctx, client, &tokens.erc20ABI, token, "nonces", owner)
+	if err != nil {
+		return false, nil
+	}
+	permitNonce := values[0].(*big.Int)
+
+	info, err := tokens.Info(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	domain, ok := permitDomain(info.Name, opts.ChainID, token, domainSeparator)
+	if !ok {
+		return false, nil
+	}
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": domain.fields,
+			"Permit": {
+				{Name: "owner", Type: "address"},
+				{Name: "spender", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Permit",
+		Domain:      domain.domain,
+		Message: apitypes.TypedDataMessage{
+			"owner":    owner.Hex(),
+			"spender":  spender.Hex(),
+			"value":    amount.String(),
+			"nonce":    permitNonce.String(),
+			"deadline": opts.Deadline.String(),
+		},
+	}
+	sig, err := opts.Signer.SignTypedData(ctx, typedData)
+	if err != nil {
+		return false, fmt.Errorf("failed to sign permit: %v", err)
+	}
+	var r, s [32]byte
+	copy(r[:], sig[:32])
+	copy(s[:], sig[32:64])
+
+	data, err := tokens.erc20ABI.Pack("permit", owner, spender, amount, opts.Deadline, sig[64]+27, r, s)
+	if err != nil {
+		return false, fmt.Errorf("failed to pack permit data: %v", err)
+	}
+	permitTx, err := signCall(ctx, client, opts, &token, big.NewInt(0), data, "permit")
+	if err != nil {
+		return false, fmt.Errorf("failed to create permit transaction: %v", err)
+	}
+	log.Printf("Permit TX hash: %s (Gas: %d)", permitTx.Hash().Hex(), permitTx.Gas())
+	b.add(name, permitTx, true)
+	return true, nil
+}
+
+// eip712Domain is a typed data domain together with the EIP712Domain fields it sets.
+type eip712Domain struct {
+	domain apitypes.TypedDataDomain
+	fields []apitypes.Type
+}
+
+// permitDomain reconstructs the EIP-712 domain of token from its name, trying the common
+// versions, since external signers sign the typed data rather than the digest. It reports
+// false when none hashes to the token's domainSeparator.
+func permitDomain(name string, chainID *big.Int, token common.Address, domainSeparator [32]byte) (eip712Domain, bool) {
+	for _, version := range []string{"1", "2", ""} {
+		candidate := eip712Domain{
+			domain: apitypes.TypedDataDomain{
+				Name:              name,
+				Version:           version,
+				ChainId:           (*math.HexOrDecimal256)(chainID),
+				VerifyingContract: token.Hex(),
+			},
+			fields: []apitypes.Type{{Name: "name", Type: "string"}},
+		}
+		if version != "" {
+			candidate.fields = append(candidate.fields, apitypes.Type{Name: "version", Type: "string"})
+		}
+		candidate.fields = append(candidate.fields,
+			apitypes.Type{Name: "chainId", Type: "uint256"},
+			apitypes.Type{Name: "verifyingContract", Type: "address"},
+		)
+
+		typedData := apitypes.TypedData{Types: apitypes.Types{"EIP712Domain": candidate.fields}, Domain: candidate.domain}
+		hash, err := typedData.HashStruct("EIP712Domain", candidate.domain.Map())
+		if err == nil && common.BytesToHash(hash) == common.Hash(domainSeparator) {
+			return candidate, true
+		}
+	}
+	return eip712Domain{}, false
+}
+
+// requiresZeroReset reports whether token refuses to change owner's non-zero allowance for
+// spender to amount, either because it is listed in configs.ZeroResetTokens or because the
+// approve reverts when simulated.
+func requiresZeroReset(ctx context.Context, tokens *TokenRegistry, token, owner, spender common.Address, amount *big.Int) bool {
+	for _, addr := range configs.ZeroResetTokens {
+		if strings.EqualFold(addr, token.Hex()) {
+			return true
+		}
+	}
+
+	data, err := tokens.erc20ABI.Pack("approve", spender, amount)
+	if err != nil {
+		return false
+	}
+	_, err = tokens.client.CallContract(ctx, ethereum.CallMsg{From: owner, To: &token, Data: data}, nil)
+	return err != nil
+}
@@ -0,0 +1,394 @@
+package atomic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
+)
+
+// bundlePlan is the operation-specific part of an atomic bundle. bundleRunner prices, simulates,
+// submits and monitors every operation the same way.
+type bundlePlan struct {
+	// steps is the number of progress steps the operation logs, the last one being submission.
+	steps int
+	// legs signs the operation's transactions through b, which hands out consecutive nonces.
+	legs func(b *legBuilder) error
+	// surplus returns the ETH value of what the simulated legs deliver above the quote's
+	// minimums, the profit a BribePercent bribe is paid from. Nil plans pay no percentage bribe.
+	surplus func(sim *flashbot.SimulationResponse, legs *legBuilder) (*big.Int, error)
+	// guard raises the quote's minimums by the coinbase payment, or restores them for nil, so
+	// the bundle reverts instead of paying a bribe its outputs do not cover.
+	guard func(bribe *big.Int)
+	// size adjusts the quote to the simulated outputs of the legs, e.g. to sell exactly what an
+	// earlier leg returns, and reports whether the legs must be signed again. Nil keeps the quote.
+	size func(sim *flashbot.SimulationResponse, legs *legBuilder) (bool, error)
+	// verify checks the simulation results beyond per-transaction success.
+	verify func(sim *flashbot.SimulationResponse, legs *legBuilder) error
+	// requote refreshes the quote and reports whether it changed. Nil disables replacement.
+	requote func(ctx context.Context) (bool, error)
+	// report logs the expected amounts and effective slippage of a dry run.
+	report func(sim *flashbot.SimulationResponse, legs *legBuilder)
+}
+
+// legBuilder collects a plan's legs in nonce order and remembers which leg plays which role.
+type legBuilder struct {
+	runner     *bundleRunner
+	gasParams  *GasParams
+	txs        []*types.Transaction
+	names      map[string]int
+	revertible []int
+}
+
+// opts is the signing context of the next leg.
+func (b *legBuilder) opts() TxOpts {
+	return b.runner.txOpts(len(b.txs), b.gasParams)
+}
+
+// add appends tx under name. Revertible legs, e.g. approvals that may already be in place,
+// may revert without invalidating the bundle.
+func (b *legBuilder) add(name string, tx *types.Transaction, revertible bool) {
+	if revertible {
+		b.revertible = append(b.revertible, len(b.txs))
+	}
+	b.names[name] = len(b.txs)
+	b.txs = append(b.txs, tx)
+}
+
+// index returns the position of the leg added under name, or -1.
+func (b *legBuilder) index(name string) int {
+	if i, ok := b.names[name]; ok {
+		return i
+	}
+	return -1
+}
+
+// name returns the name the leg at index i was added under.
+func (b *legBuilder) name(i int) string {
+	for name, index := range b.names {
+		if index == i {
+			return name
+		}
+	}
+	return ""
+}
+
+// swapLeg names the leg whose backrun value is refunded in MEV-Share mode.
+const swapLeg = "swap"
+
+// bribeLeg names the coinbase payment appended after the plan's legs.
+const bribeLeg = "bribe"
+
+type bundleRunner struct {
+	fb       *flashbot.Client
+	config   *configs.Config
+	eoa      signer.Signer
+	chainID  *big.Int
+	lease    *NonceLease
+	deadline *big.Int
+
+	// legs is the layout of the most recently built bundle.
+	legs *legBuilder
+}
+
+// txOpts is the signing context of the leg at index i of the bundle.
+func (r *bundleRunner) txOpts(i int, gasParams *GasParams) TxOpts {
+	return TxOpts{Signer: r.eoa, ChainID: r.chainID, Nonce: r.lease.Base + uint64(i), GasParams: gasParams, Deadline: r.deadline}
+}
+
+// build signs the plan's legs and, when bribing, appends the coinbase payment with the other
+// legs' tips lowered since the builder is paid directly. Plans that size legs from simulated
+// outputs are simulated first and signed again with the sized amounts. A percentage bribe is
+// sized from the simulated surplus, and any bribe raises the plan's minimums by its amount.
+func (r *bundleRunner) build(ctx context.Context, plan *bundlePlan, gasParams *GasParams) ([]*types.Transaction, error) {
+	fixedBribe := r.config.CoinbaseBribe != nil && r.config.CoinbaseBribe.Sign() > 0
+	bribing := fixedBribe || (r.config.BribePercent > 0 && plan.surplus != nil)
+	legParams := gasParams
+	if bribing {
+		legParams = withBribeTip(gasParams)
+	}
+	if plan.guard != nil {
+		plan.guard(nil)
+	}
+
+	if _, err := r.signLegs(plan, legParams); err != nil {
+		return nil, err
+	}
+	var sim *flashbot.SimulationResponse
+	if plan.size != nil || (bribing && !fixedBribe) {
+		var err error
+		if sim, err = r.simulateLegs(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if plan.size != nil && sim != nil {
+		changed, err := plan.size(sim, r.legs)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			if _, err := r.signLegs(plan, legParams); err != nil {
+				return nil, err
+			}
+			if bribing && !fixedBribe {
+				if sim, err = r.simulateLegs(ctx); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var bribe *big.Int
+	if bribing {
+		bribe = r.bribe(plan, sim)
+	}
+	switch {
+	case bribe != nil && plan.guard != nil:
+		plan.guard(bribe)
+		if _, err := r.signLegs(plan, legParams); err != nil {
+			return nil, err
+		}
+	case bribe == nil && bribing:
+		// No surplus to pay from, so the legs tip the builder as usual
+		if _, err := r.signLegs(plan, gasParams); err != nil {
+			return nil, err
+		}
+	}
+	b := r.legs
+	if bribe == nil {
+		return b.txs, nil
+	}
+
+	bribeTx, err := createBribeTransaction(ctx, r.fb.Eth(), b.opts(), bribe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coinbase bribe transaction: %v", err)
+	}
+	log.Printf("Coinbase bribe TX hash: %s (%s ETH, Gas: %d)", bribeTx.Hash().Hex(), WeiToEth(bribe.String()), bribeTx.Gas())
+	b.add(bribeLeg, bribeTx, false)
+
+	return b.txs, nil
+}
+
+// bribe returns the coinbase payment for the signed legs: the fixed CoinbaseBribe, or
+// BribePercent of the surplus the plan reads from sim. Without a simulated surplus there is no
+// percentage bribe.
+func (r *bundleRunner) bribe(plan *bundlePlan, sim *flashbot.SimulationResponse) *big.Int {
+	surplus := new(big.Int)
+	if r.config.CoinbaseBribe == nil || r.config.CoinbaseBribe.Sign() <= 0 {
+		if sim == nil {
+			log.Printf("⚠️  No coinbase bribe: the legs could not be simulated")
+			return nil
+		}
+		var err error
+		if surplus, err = plan.surplus(sim, r.legs); err != nil {
+			log.Printf("⚠️  No coinbase bribe: %v", err)
+			return nil
+		}
+		log.Printf("Simulated surplus: %s ETH", WeiToEth(surplus.String()))
+	}
+	return bribeAmount(r.config, surplus)
+}
+
+// signLegs signs the plan's legs for the current quote and makes them the runner's layout.
+func (r *bundleRunner) signLegs(plan *bundlePlan, gasParams *GasParams) (*legBuilder, error) {
+	b := &legBuilder{runner: r, gasParams: gasParams, names: make(map[string]int)}
+	if err := plan.legs(b); err != nil {
+		return nil, err
+	}
+	r.legs = b
+	return b, nil
+}
+
+// simulateLegs simulates the signed legs for the plan to size them and the bribe from. A later
+// leg that reverts because of the old sizes still leaves the earlier results to read; transport
+// failures return no simulation, which keeps the quoted amounts.
+func (r *bundleRunner) simulateLegs(ctx context.Context) (*flashbot.SimulationResponse, error) {
+	sim, err := r.fb.SimulateBundle(ctx, r.legs.txs, r.bundleOptions()(r.legs.txs)...)
+	var revertErr *flashbot.SimulationRevertError
+	switch {
+	case errors.As(err, &revertErr) && sim != nil:
+	case err != nil && flashbot.IsRetryable(err):
+		log.Printf("⚠️  Could not simulate the legs, keeping the quoted amounts: %v", err)
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to simulate legs: %w", err)
+	}
+	return sim, nil
+}
+
+// bundleOptions bounds the bundle to the deadline and lets the revertible legs of the latest
+// build revert without invalidating the others.
+func (r *bundleRunner) bundleOptions() func(txs []*types.Transaction) []flashbot.BundleOption {
+	return func(txs []*types.Transaction) []flashbot.BundleOption {
+		opts := []flashbot.BundleOption{
+			flashbot.WithMinTimestamp(uint64(time.Now().Unix())),
+			flashbot.WithMaxTimestamp(r.deadline.Uint64()),
+		}
+		for _, i := range r.legs.revertible {
+			opts = append(opts, flashbot.WithRevertingTxHashes(txs[i].Hash()))
+		}
+		return opts
+	}
+}
+
+func (r *bundleRunner) run(ctx context.Context, plan *bundlePlan, gasParams *GasParams) error {
+	client := r.fb.Eth()
+
+	transactions, err := r.build(ctx, plan, gasParams)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("\n[%d/%d] Bundling and sending to Flashbots...", plan.steps, plan.steps)
+
+	// Calculate total gas fees
+	var totalGasUsed uint64
+	for _, tx := range transactions {
+		totalGasUsed += tx.Gas()
+	}
+	var totalFees *big.Int
+	if gasParams.IsLegacy {
+		totalFees = new(big.Int).Mul(gasParams.LegacyGasPrice, new(big.Int).SetUint64(totalGasUsed))
+	} else {
+		totalFees = new(big.Int).Mul(gasParams.MaxFeePerGas, new(big.Int).SetUint64(totalGasUsed))
+	}
+	log.Printf("📊 Bundle Stats: Total Gas=%d, Est. Fees=~%s ETH", totalGasUsed, WeiToEth(totalFees.String()))
+
+	bundleOptions := r.bundleOptions()
+
+	// Simulate bundle first. Reverts and relay rejections are permanent; transport failures
+	// only cost us the pre-flight check, so the bundle is still submitted. A dry run has nothing
+	// to report without the simulation.
+	simResult, err := r.fb.SimulateBundle(ctx, transactions, bundleOptions(transactions)...)
+	if err != nil && (r.config.DryRun || !flashbot.IsRetryable(err)) {
+		return fmt.Errorf("bundle simulation failed: %w", err)
+	} else if err != nil {
+		log.Printf("⚠️  Bundle simulation failed: %v", err)
+	} else {
+		log.Println("✅ Bundle simulation successful!")
+		for i, result := range simResult.Result.Results {
+			if result.Error != "" {
+				log.Printf("   TX %d reverted (allowed): %s - %s", i+1, result.Error, result.Revert)
+				continue
+			}
+			log.Printf("   TX %d: Gas used %s, Gas fees %s ETH", i+1, result.GasUsed, WeiToEth(result.GasFees))
+		}
+
+		log.Printf("   Coinbase diff: %s ETH (sent directly: %s ETH, gas fees: %s ETH), bundle gas price %s Gwei",
+			WeiToEth(simResult.Result.CoinbaseDiff), WeiToEth(simResult.Result.EthSentToCoinbase), WeiToEth(simResult.Result.GasFees), weiStringToGwei(simResult.Result.BundleGasPrice))
+		if i := r.legs.index(bribeLeg); i >= 0 && i < len(simResult.Result.Results) {
+			log.Printf("   Coinbase bribe leg sent %s ETH to the builder", WeiToEth(simResult.Result.Results[i].EthSentToCoinbase))
+		}
+
+		if plan.verify != nil {
+			if err := plan.verify(simResult, r.legs); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.config.DryRun {
+		r.reportDryRun(plan, transactions, simResult)
+		return nil
+	}
+
+	if r.config.SubmissionMode == configs.SUBMISSION_MODE_MEV_SHARE {
+		block, err := r.submitViaMevShare(ctx, transactions)
+		if err != nil {
+			return err
+		}
+		// MEV-Share bundles are not tracked by flashbots_getBundleStatsV2
+		return r.monitor(ctx, transactions, block, block+r.config.BlockWindow-1, nil)
+	}
+
+	submitOptions := flashbot.SubmitOptions{
+		BlockWindow:   r.config.BlockWindow,
+		Deadline:      time.Unix(r.deadline.Int64(), 0),
+		BundleOptions: bundleOptions,
+		Rebuild: func(ctx context.Context) ([]*types.Transaction, error) {
+			freshGasParams, err := CalculateDynamicGasParams(ctx, client, r.config.Gas)
+			if err != nil {
+				return nil, err
+			}
+			gasParams = freshGasParams
+			return r.build(ctx, plan, gasParams)
+		},
+	}
+	if plan.requote != nil {
+		submitOptions.Requote = func(ctx context.Context, header *types.Header) ([]*types.Transaction, error) {
+			changed, err := plan.requote(ctx)
+			if err != nil || !changed {
+				return nil, err
+			}
+			return r.build(ctx, plan, gasParams)
+		}
+	}
+
+	// Resubmit the bundle for each block in the window until it lands or the deadline passes
+	submitResult, err := r.fb.SubmitBundleOverWindow(ctx, transactions, submitOptions)
+	if err != nil {
+		if submitResult != nil {
+			reportBundleStats(ctx, r.fb, submitResult.BundleHashes)
+		}
+		return fmt.Errorf("failed to land bundle: %w", err)
+	}
+
+	log.Printf("🎯 Bundle included in block %d after %d submission(s)", submitResult.IncludedBlock, len(submitResult.BundleHashes))
+
+	// Confirm every transaction of the landed bundle
+	return r.monitor(ctx, submitResult.Txs, submitResult.IncludedBlock, submitResult.IncludedBlock, submitResult.BundleHashes)
+}
+
+// monitor waits for txs to land between firstBlock and lastBlock and turns anything short of
+// full inclusion, apart from reverts of the revertible legs, into an *InclusionError.
+func (r *bundleRunner) monitor(ctx context.Context, txs []*types.Transaction, firstBlock, lastBlock uint64, bundleHashes map[uint64]string) error {
+	result, err := monitorBundleInclusion(ctx, r.fb, r.lease, txs, firstBlock, lastBlock, bundleHashes, 60*time.Second)
+	if err != nil {
+		return err
+	}
+	return result.Err(r.legs.revertible)
+}
+
+// submitViaMevShare sends the bundle once through mev_sendBundle, valid for the whole block window,
+// refunding config.RefundPercent of the value backrunners extract from the swap leg. It returns
+// the first block of the window.
+func (r *bundleRunner) submitViaMevShare(ctx context.Context, txs []*types.Transaction) (uint64, error) {
+	header, err := r.fb.Eth().HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest block: %v", err)
+	}
+	block := header.Number.Uint64() + 1
+
+	canRevert := make(map[int]bool)
+	for _, i := range r.legs.revertible {
+		canRevert[i] = true
+	}
+
+	bundle, err := flashbot.NewMevShareBundle(txs, flashbot.MevShareParams{
+		Block:         block,
+		MaxBlock:      block + r.config.BlockWindow - 1,
+		RefundTxIndex: r.legs.index(swapLeg),
+		RefundPercent: r.config.RefundPercent,
+		Hints:         r.config.MevShareHints,
+		CanRevert:     canRevert,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to build MEV-Share bundle: %v", err)
+	}
+
+	result, err := r.fb.SendMevShareBundle(ctx, bundle)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send MEV-Share bundle: %w", err)
+	}
+
+	log.Printf("🎯 MEV-Share bundle submitted for blocks %d-%d (refund %d%%): %s", block, block+r.config.BlockWindow-1, r.config.RefundPercent, result.Result.BundleHash)
+	return block, nil
+}
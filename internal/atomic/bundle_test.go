@@ -0,0 +1,71 @@
+package atomic_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/testchain"
+)
+
+func TestBundleIsResubmittedUntilItLands(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	relay.LoseNext(2)
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+
+	if n := relay.Calls("eth_sendBundle"); n != 3 {
+		t.Errorf("expected the bundle to land on the third submission, got %d submissions", n)
+	}
+	if n := relay.Calls("eth_cancelBundle"); n != 0 {
+		t.Errorf("cancelled an unchanged bundle %d time(s)", n)
+	}
+	if lp := chain.LPBalance(t, chain.EOA()); lp.Sign() <= 0 {
+		t.Errorf("expected LP tokens after the zap, got %s", lp)
+	}
+}
+
+func TestMovedPoolCancelsAndRequotesTheBundle(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	relay.LoseNext(1, chain.Trade(t, big.NewInt(params.Ether)))
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+
+	if n := relay.Calls("eth_cancelBundle"); n != 1 {
+		t.Errorf("expected the stale bundle to be cancelled once, got %d cancellations", n)
+	}
+	if n := relay.Calls("eth_sendBundle"); n != 2 {
+		t.Errorf("expected the requoted bundle to land on the second submission, got %d submissions", n)
+	}
+	if lp := chain.LPBalance(t, chain.EOA()); lp.Sign() <= 0 {
+		t.Errorf("expected LP tokens after the zap, got %s", lp)
+	}
+}
+
+func TestSmallPoolMoveKeepsTheBundle(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	// A 0.001 ETH trade moves the 10 ETH pool by about 0.02%, inside the requote threshold
+	relay.LoseNext(1, chain.Trade(t, big.NewInt(params.Ether/1000)))
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+
+	if n := relay.Calls("eth_cancelBundle"); n != 0 {
+		t.Errorf("expected the bundle to survive a small move, got %d cancellations", n)
+	}
+	if n := relay.Calls("eth_sendBundle"); n != 2 {
+		t.Errorf("expected the bundle to land on the second submission, got %d submissions", n)
+	}
+}
@@ -0,0 +1,91 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// SwapParams describes an exact-input swap along Path. ETHIn and ETHOut select native ETH on
+// the WETH end of the path.
+type SwapParams struct {
+	AmountIn      *big.Int
+	AmountOutMin  *big.Int
+	Path          []common.Address
+	ETHIn         bool
+	ETHOut        bool
+	FeeOnTransfer bool
+}
+
+// LiquidityParams describes a Token/ETH deposit.
+type LiquidityParams struct {
+	Token       common.Address
+	TokenAmount *big.Int
+	TokenMin    *big.Int
+	ETHAmount   *big.Int
+	ETHMin      *big.Int
+}
+
+// DEX is an exchange the zap can swap on and deposit into.
+type DEX interface {
+	Name() string
+	// WETH is the wrapped ETH the DEX pairs tokens against.
+	WETH() common.Address
+	// SwapSpender and LiquiditySpender are the contracts that pull tokens for swaps and deposits.
+	SwapSpender() common.Address
+	LiquiditySpender() common.Address
+	// Pool returns the pool trading tokenA against tokenB.
+	Pool(ctx context.Context, tokenA, tokenB common.Address) (common.Address, error)
+	// Quote returns the output of swapping amountIn along path.
+	Quote(ctx context.Context, amountIn *big.Int, path []common.Address) (*big.Int, error)
+	// ZapSwapAmount returns how much of ethAmount to swap into token before depositing the rest.
+	ZapSwapAmount(ctx context.Context, token common.Address, ethAmount *big.Int) (*big.Int, error)
+	// DepositAmounts returns how much of tokenAmount and ethAmount a deposit into the token/WETH
+	// pool takes at its current price.
+	DepositAmounts(ctx context.Context, token common.Address, tokenAmount, ethAmount *big.Int) (*big.Int, *big.Int, error)
+	// SwapOutput decodes the amount received from the return data of a BuildSwap transaction.
+	SwapOutput(returnData []byte) (*big.Int, error)
+	// LiquidityOutput decodes the liquidity minted from the return data of a BuildAddLiquidity transaction.
+	LiquidityOutput(returnData []byte) (*big.Int, error)
+	BuildSwap(ctx context.Context, opts TxOpts, params SwapParams) (*types.Transaction, error)
+	BuildAddLiquidity(ctx context.Context, opts TxOpts, params LiquidityParams) (*types.Transaction, error)
+}
+
+// NewDEX returns the DEX selected by config.Dex. V2 forks use the deployment from
+// configs.KnownV2Dexes unless config.RouterAddress or config.FactoryAddress override it, Uniswap
+// V3 the config.V3* deployment, and both config.WETHAddress from the network profile.
+func NewDEX(client *ethclient.Client, config *configs.Config) (DEX, error) {
+	if config.WETHAddress == (common.Address{}) {
+		return nil, fmt.Errorf("no WETH address configured")
+	}
+	if config.Dex == configs.DEX_UNISWAP_V3 {
+		deployment := V3Deployment{
+			Factory:         config.V3Factory,
+			Router:          config.V3Router,
+			Quoter:          config.V3Quoter,
+			PositionManager: config.V3PositionManager,
+			WETH:            config.WETHAddress,
+		}
+		return NewUniswapV3(client, deployment, config.V3FeeTier, config.V3TickLower, config.V3TickUpper)
+	}
+
+	deployment, ok := configs.KnownV2Dexes[config.Dex]
+	if !ok {
+		return nil, fmt.Errorf("unknown DEX %q", config.Dex)
+	}
+	router := common.HexToAddress(deployment.Router)
+	if config.RouterAddress != (common.Address{}) {
+		router = config.RouterAddress
+	}
+	factory := common.HexToAddress(deployment.Factory)
+	if config.FactoryAddress != (common.Address{}) {
+		factory = config.FactoryAddress
+	}
+	return NewUniswapV2(client, config.Dex, router, factory, config.WETHAddress)
+}
@@ -0,0 +1,131 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// UniswapV2 is a Uniswap V2 router and factory, or any fork sharing their ABIs.
+type UniswapV2 struct {
+	name      string
+	client    *ethclient.Client
+	router    common.Address
+	factory   common.Address
+	weth      common.Address
+	routerABI abi.ABI
+}
+
+// NewUniswapV2 trades through router and factory, whose pairs quote ETH as weth.
+func NewUniswapV2(client *ethclient.Client, name string, router, factory, weth common.Address) (*UniswapV2, error) {
+	routerABI, err := abi.JSON(strings.NewReader(configs.RouterABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse router ABI: %v", err)
+	}
+	return &UniswapV2{name: name, client: client, router: router, factory: factory, weth: weth, routerABI: routerABI}, nil
+}
+
+func (d *UniswapV2) Name() string {
+	return d.name
+}
+
+func (d *UniswapV2) WETH() common.Address {
+	return d.weth
+}
+
+func (d *UniswapV2) Router() common.Address {
+	return d.router
+}
+
+func (d *UniswapV2) SwapSpender() common.Address {
+	return d.router
+}
+
+func (d *UniswapV2) LiquiditySpender() common.Address {
+	return d.router
+}
+
+func (d *UniswapV2) Pool(ctx context.Context, tokenA, tokenB common.Address) (common.Address, error) {
+	reserves, err := d.Reserves(ctx, tokenA, tokenB)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return reserves.Pair, nil
+}
+
+// Reserves returns the tokenIn/tokenOut pair reserves with ReserveIn belonging to tokenIn.
+func (d *UniswapV2) Reserves(ctx context.Context, tokenIn, tokenOut common.Address) (*PairReserves, error) {
+	return getPairReserves(ctx, d.client, d.factory, tokenIn, tokenOut)
+}
+
+func (d *UniswapV2) Quote(ctx context.Context, amountIn *big.Int, path []common.Address) (*big.Int, error) {
+	return getAmountsOut(ctx, d.client, d.router, &d.routerABI, amountIn, path)
+}
+
+func (d *UniswapV2) ZapSwapAmount(ctx context.Context, token common.Address, ethAmount *big.Int) (*big.Int, error) {
+	reserves, err := d.Reserves(ctx, d.weth, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pair reserves: %v", err)
+	}
+	return calculateZapSwapAmount(reserves.ReserveIn, ethAmount), nil
+}
+
+// DepositAmounts follows UniswapV2Router02._addLiquidity: the pair takes all of one side and
+// the other at the reserve ratio.
+func (d *UniswapV2) DepositAmounts(ctx context.Context, token common.Address, tokenAmount, ethAmount *big.Int) (*big.Int, *big.Int, error) {
+	reserves, err := d.Reserves(ctx, token, d.weth)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get pair reserves: %v", err)
+	}
+	ethOptimal := new(big.Int).Mul(tokenAmount, reserves.ReserveOut)
+	ethOptimal.Div(ethOptimal, reserves.ReserveIn)
+	if ethOptimal.Cmp(ethAmount) <= 0 {
+		return tokenAmount, ethOptimal, nil
+	}
+	tokenOptimal := new(big.Int).Mul(ethAmount, reserves.ReserveIn)
+	tokenOptimal.Div(tokenOptimal, reserves.ReserveOut)
+	return tokenOptimal, ethAmount, nil
+}
+
+func (d *UniswapV2) SwapOutput(returnData []byte) (*big.Int, error) {
+	var amounts []*big.Int
+	if err := d.routerABI.UnpackIntoInterface(&amounts, "swapExactETHForTokens", returnData); err != nil {
+		return nil, fmt.Errorf("failed to unpack swap amounts: %v", err)
+	}
+	if len(amounts) < 2 {
+		return nil, fmt.Errorf("invalid swap amounts")
+	}
+	return amounts[len(amounts)-1], nil
+}
+
+func (d *UniswapV2) LiquidityOutput(returnData []byte) (*big.Int, error) {
+	values, err := d.routerABI.Unpack("addLiquidityETH", returnData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack liquidity amounts: %v", err)
+	}
+	return values[2].(*big.Int), nil
+}
+
+func (d *UniswapV2) BuildSwap(ctx context.Context, opts TxOpts, params SwapParams) (*types.Transaction, error) {
+	if params.ETHIn {
+		return createSwapTransaction(ctx, d.client, opts, params.AmountIn, params.AmountOutMin, params.Path, params.FeeOnTransfer, d.router, d.weth, &d.routerABI)
+	}
+	return createTokenSwapTransaction(ctx, d.client, opts, params.AmountIn, params.AmountOutMin, params.Path, params.ETHOut, params.FeeOnTransfer, d.router, d.weth, &d.routerABI)
+}
+
+func (d *UniswapV2) BuildAddLiquidity(ctx context.Context, opts TxOpts, params LiquidityParams) (*types.Transaction, error) {
+	return createAddLiquidityTransaction(ctx, d.client, opts, params.Token, params.TokenAmount, params.TokenMin, params.ETHAmount, params.ETHMin, d.router, &d.routerABI)
+}
+
+// BuildRemoveLiquidity burns liquidity of the Token/WETH pair for tokens and ETH.
+func (d *UniswapV2) BuildRemoveLiquidity(ctx context.Context, opts TxOpts, token common.Address, liquidity, amountTokenMin, amountETHMin *big.Int, feeOnTransfer bool) (*types.Transaction, error) {
+	return createRemoveLiquidityTransaction(ctx, d.client, opts, token, liquidity, amountTokenMin, amountETHMin, feeOnTransfer, d.router, &d.routerABI)
+}
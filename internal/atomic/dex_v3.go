@@ -0,0 +1,394 @@
+package atomic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// v3MaxTick bounds the ticks of every Uniswap V3 pool.
+const v3MaxTick = 887272
+
+// v3TickSpacing maps each enabled fee tier to its pool tick spacing.
+var v3TickSpacing = map[int64]int64{100: 1, 500: 10, 3000: 60, 10000: 200}
+
+// exactInputParams mirrors ISwapRouter.ExactInputParams for ABI packing.
+type exactInputParams struct {
+	Path             []byte
+	Recipient        common.Address
+	Deadline         *big.Int
+	AmountIn         *big.Int
+	AmountOutMinimum *big.Int
+}
+
+// mintParams mirrors INonfungiblePositionManager.MintParams for ABI packing.
+type mintParams struct {
+	Token0         common.Address
+	Token1         common.Address
+	Fee            *big.Int
+	TickLower      *big.Int
+	TickUpper      *big.Int
+	Amount0Desired *big.Int
+	Amount1Desired *big.Int
+	Amount0Min     *big.Int
+	Amount1Min     *big.Int
+	Recipient      common.Address
+	Deadline       *big.Int
+}
+
+// V3Deployment is the set of Uniswap V3 contracts on one chain.
+type V3Deployment struct {
+	Factory         common.Address
+	Router          common.Address // SwapRouter
+	Quoter          common.Address // QuoterV2
+	PositionManager common.Address // NonfungiblePositionManager
+	WETH            common.Address
+}
+
+// UniswapV3 swaps through SwapRouter on pools of a single fee tier, quotes with QuoterV2 and
+// deposits through NonfungiblePositionManager.mint over a fixed tick range.
+type UniswapV3 struct {
+	client      *ethclient.Client
+	deployment  V3Deployment
+	fee         int64
+	tickLower   int64
+	tickUpper   int64
+	factoryABI  abi.ABI
+	poolABI     abi.ABI
+	quoterABI   abi.ABI
+	routerABI   abi.ABI
+	positionABI abi.ABI
+}
+
+// NewUniswapV3 trades through deployment on pools of the given fee tier. A zero tick range
+// selects the full range.
+func NewUniswapV3(client *ethclient.Client, deployment V3Deployment, fee, tickLower, tickUpper int64) (*UniswapV3, error) {
+	spacing, ok := v3TickSpacing[fee]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Uniswap V3 fee tier %d", fee)
+	}
+	if tickLower == 0 && tickUpper == 0 {
+		tickLower = -v3MaxTick / spacing * spacing
+		tickUpper = v3MaxTick / spacing * spacing
+	}
+	if tickLower%spacing != 0 || tickUpper%spacing != 0 {
+		return nil, fmt.Errorf("tick range [%d, %d] is not a multiple of tick spacing %d", tickLower, tickUpper, spacing)
+	}
+	if tickLower >= tickUpper || tickLower < -v3MaxTick || tickUpper > v3MaxTick {
+		return nil, fmt.Errorf("invalid tick range [%d, %d]", tickLower, tickUpper)
+	}
+
+	d := &UniswapV3{client: client, deployment: deployment, fee: fee, tickLower: tickLower, tickUpper: tickUpper}
+	for _, parsed := range []struct {
+		target *abi.ABI
+		json   string
+	}{
+		{&d.factoryABI, configs.V3FactoryABI},
+		{&d.poolABI, configs.V3PoolABI},
+		{&d.quoterABI, configs.QuoterV2ABI},
+		{&d.routerABI, configs.V3SwapRouterABI},
+		{&d.positionABI, configs.PositionManagerABI},
+	} {
+		contractABI, err := abi.JSON(strings.NewReader(parsed.json))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Uniswap V3 ABI: %v", err)
+		}
+		*parsed.target = contractABI
+	}
+	return d, nil
+}
+
+func (d *UniswapV3) Name() string {
+	return configs.DEX_UNISWAP_V3
+}
+
+func (d *UniswapV3) WETH() common.Address {
+	return d.deployment.WETH
+}
+
+func (d *UniswapV3) SwapSpender() common.Address {
+	return d.deployment.Router
+}
+
+func (d *UniswapV3) LiquiditySpender() common.Address {
+	return d.deployment.PositionManager
+}
+
+func (d *UniswapV3) Pool(ctx context.Context, tokenA, tokenB common.Address) (common.Address, error) {
+	values, err := callView(ctx, d.client, &d.factoryABI, d.deployment.Factory, "getPool", tokenA, tokenB, big.NewInt(d.fee))
+	if err != nil {
+		return common.Address{}, err
+	}
+	pool := values[0].(common.Address)
+	if pool == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("no %d fee pool for %s/%s", d.fee, tokenA.Hex(), tokenB.Hex())
+	}
+	return pool, nil
+}
+
+// encodePath packs path as token, fee, token, ... using the configured fee tier for every hop.
+func (d *UniswapV3) encodePath(path []common.Address) []byte {
+	fee := []byte{byte(d.fee >> 16), byte(d.fee >> 8), byte(d.fee)}
+	encoded := path[0].Bytes()
+	for _, token := range path[1:] {
+		encoded = append(encoded, fee...)
+		encoded = append(encoded, token.Bytes()...)
+	}
+	return encoded
+}
+
+func (d *UniswapV3) Quote(ctx context.Context, amountIn *big.Int, path []common.Address) (*big.Int, error) {
+	values, err := callView(ctx, d.client, &d.quoterABI, d.deployment.Quoter, "quoteExactInput", d.encodePath(path), amountIn)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].(*big.Int), nil
+}
+
+// ZapSwapAmount splits ethAmount by the token/ETH value ratio a position over the tick range
+// holds at the current pool price. Unlike the V2 formula it ignores the swap's own price impact.
+func (d *UniswapV3) ZapSwapAmount(ctx context.Context, token common.Address, ethAmount *big.Int) (*big.Int, error) {
+	tokenPerLiquidity, ethPerLiquidity, ethPerToken, err := d.positionAmounts(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Value of the token side in ETH, and the share of the position's value held in the token
+	tokenValue := newV3Float().Mul(tokenPerLiquidity, ethPerToken)
+	total := newV3Float().Add(tokenValue, ethPerLiquidity)
+	if total.Sign() == 0 {
+		return nil, fmt.Errorf("empty position range [%d, %d]", d.tickLower, d.tickUpper)
+	}
+	tokenShare := newV3Float().Quo(tokenValue, total)
+
+	swapAmount, _ := tokenShare.Mul(tokenShare, newV3Float().SetInt(ethAmount)).Int(nil)
+	return swapAmount, nil
+}
+
+// DepositAmounts scales a position over the tick range at the current pool price to the largest
+// one tokenAmount and ethAmount cover, as the position manager does when minting.
+func (d *UniswapV3) DepositAmounts(ctx context.Context, token common.Address, tokenAmount, ethAmount *big.Int) (*big.Int, *big.Int, error) {
+	tokenPerLiquidity, ethPerLiquidity, _, err := d.positionAmounts(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var liquidity *big.Float
+	for _, side := range []struct {
+		amount       *big.Int
+		perLiquidity *big.Float
+	}{
+		{tokenAmount, tokenPerLiquidity},
+		{ethAmount, ethPerLiquidity},
+	} {
+		if side.perLiquidity.Sign() == 0 {
+			continue
+		}
+		covered := newV3Float().Quo(newV3Float().SetInt(side.amount), side.perLiquidity)
+		if liquidity == nil || covered.Cmp(liquidity) < 0 {
+			liquidity = covered
+		}
+	}
+	if liquidity == nil {
+		return nil, nil, fmt.Errorf("empty position range [%d, %d]", d.tickLower, d.tickUpper)
+	}
+
+	tokenDeposit, _ := newV3Float().Mul(tokenPerLiquidity, liquidity).Int(nil)
+	ethDeposit, _ := newV3Float().Mul(ethPerLiquidity, liquidity).Int(nil)
+	return tokenDeposit, ethDeposit, nil
+}
+
+// positionAmounts returns the token and ETH a unit of liquidity over the tick range holds at the
+// current pool price, and that price in ETH per token.
+func (d *UniswapV3) positionAmounts(ctx context.Context, token common.Address) (tokenPerLiquidity, ethPerLiquidity, ethPerToken *big.Float, err error) {
+	pool, err := d.Pool(ctx, d.WETH(), token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	values, err := callView(ctx, d.client, &d.poolABI, pool, "slot0")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sqrtPriceX96 := values[0].(*big.Int)
+	values, err = callView(ctx, d.client, &d.poolABI, pool, "token0")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	token0 := values[0].(common.Address)
+
+	// Amounts per unit of liquidity, with prices as token1 per token0
+	sqrtPrice := newV3Float().SetInt(sqrtPriceX96)
+	sqrtPrice.SetMantExp(sqrtPrice, -96)
+	price := newV3Float().Mul(sqrtPrice, sqrtPrice)
+	sqrtLower := sqrtPriceAtTick(d.tickLower)
+	sqrtUpper := sqrtPriceAtTick(d.tickUpper)
+	if sqrtPrice.Cmp(sqrtLower) < 0 {
+		sqrtPrice = sqrtLower
+	}
+	if sqrtPrice.Cmp(sqrtUpper) > 0 {
+		sqrtPrice = sqrtUpper
+	}
+	amount0 := newV3Float().Sub(sqrtUpper, sqrtPrice)
+	amount0.Quo(amount0, newV3Float().Mul(sqrtPrice, sqrtUpper))
+	amount1 := newV3Float().Sub(sqrtPrice, sqrtLower)
+
+	if token0 == token {
+		return amount0, amount1, price, nil
+	}
+	if price.Sign() == 0 {
+		return nil, nil, nil, fmt.Errorf("pool %s has no price", pool.Hex())
+	}
+	return amount1, amount0, newV3Float().Quo(newV3Float().SetInt64(1), price), nil
+}
+
+// newV3Float returns a big.Float precise enough for Q64.96 prices and wei amounts.
+func newV3Float() *big.Float {
+	return new(big.Float).SetPrec(256)
+}
+
+// sqrtPriceAtTick returns sqrt(1.0001^tick), the square root price at the edge of tick.
+func sqrtPriceAtTick(tick int64) *big.Float {
+	base := newV3Float().Sqrt(newV3Float().SetFloat64(1.0001))
+	result := newV3Float().SetInt64(1)
+	for n := abs64(tick); n > 0; n >>= 1 {
+		if n&1 == 1 {
+			result.Mul(result, base)
+		}
+		base.Mul(base, base)
+	}
+	if tick < 0 {
+		result.Quo(newV3Float().SetInt64(1), result)
+	}
+	return result
+}
+
+func abs64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (d *UniswapV3) SwapOutput(returnData []byte) (*big.Int, error) {
+	values, err := d.routerABI.Unpack("exactInput", returnData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack swap output: %v", err)
+	}
+	return values[0].(*big.Int), nil
+}
+
+// LiquidityOutput reads the liquidity of the position from the mint call of the multicall.
+func (d *UniswapV3) LiquidityOutput(returnData []byte) (*big.Int, error) {
+	values, err := d.positionABI.Unpack("multicall", returnData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack multicall results: %v", err)
+	}
+	results := values[0].([][]byte)
+	if len(results) == 0 {
+		return nil, fmt.Errorf("multicall returned no results")
+	}
+	values, err = d.positionABI.Unpack("mint", results[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack mint output: %v", err)
+	}
+	return values[1].(*big.Int), nil
+}
+
+func (d *UniswapV3) BuildSwap(ctx context.Context, opts TxOpts, params SwapParams) (*types.Transaction, error) {
+	if params.FeeOnTransfer {
+		return nil, fmt.Errorf("fee-on-transfer tokens are not supported on Uniswap V3")
+	}
+	if _, err := swapMethod(params.Path, d.WETH(), params.ETHIn, params.ETHOut, false); err != nil {
+		return nil, err
+	}
+
+	router := d.deployment.Router
+	swap := exactInputParams{
+		Path:             d.encodePath(params.Path),
+		Recipient:        opts.From(),
+		Deadline:         opts.Deadline,
+		AmountIn:         params.AmountIn,
+		AmountOutMinimum: params.AmountOutMin,
+	}
+	value := big.NewInt(0)
+	if params.ETHIn {
+		// SwapRouter wraps msg.value when the path starts with WETH
+		value = params.AmountIn
+	}
+	if params.ETHOut {
+		// WETH is paid to the router and unwrapped to the sender in the same call
+		swap.Recipient = router
+	}
+
+	data, err := d.routerABI.Pack("exactInput", swap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack swap data: %v", err)
+	}
+	if params.ETHOut {
+		unwrap, err := d.routerABI.Pack("unwrapWETH9", params.AmountOutMin, opts.From())
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack unwrap data: %v", err)
+		}
+		data, err = d.routerABI.Pack("multicall", [][]byte{data, unwrap})
+		if err != nil {
+			return nil, fmt.Errorf("failed to pack multicall data: %v", err)
+		}
+	}
+	return signCall(ctx, d.client, opts, &router, value, data, "swap")
+}
+
+// BuildAddLiquidity mints a position over the tick range, refunding the ETH the range does not
+// take. mint reverts unless the position takes at least params.TokenMin and params.ETHMin, which
+// bounds both the pool price at execution and the share of the deposit the range leaves unused.
+func (d *UniswapV3) BuildAddLiquidity(ctx context.Context, opts TxOpts, params LiquidityParams) (*types.Transaction, error) {
+	weth := d.WETH()
+	tokenMin, ethMin := params.TokenMin, params.ETHMin
+	if tokenMin == nil {
+		tokenMin = big.NewInt(0)
+	}
+	if ethMin == nil {
+		ethMin = big.NewInt(0)
+	}
+	mint := mintParams{
+		Token0:         params.Token,
+		Token1:         weth,
+		Fee:            big.NewInt(d.fee),
+		TickLower:      big.NewInt(d.tickLower),
+		TickUpper:      big.NewInt(d.tickUpper),
+		Amount0Desired: params.TokenAmount,
+		Amount1Desired: params.ETHAmount,
+		Amount0Min:     tokenMin,
+		Amount1Min:     ethMin,
+		Recipient:      opts.From(),
+		Deadline:       opts.Deadline,
+	}
+	if bytes.Compare(weth.Bytes(), params.Token.Bytes()) < 0 {
+		mint.Token0, mint.Token1 = weth, params.Token
+		mint.Amount0Desired, mint.Amount1Desired = params.ETHAmount, params.TokenAmount
+		mint.Amount0Min, mint.Amount1Min = ethMin, tokenMin
+	}
+
+	mintData, err := d.positionABI.Pack("mint", mint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack mint data: %v", err)
+	}
+	refundData, err := d.positionABI.Pack("refundETH")
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack refund data: %v", err)
+	}
+	data, err := d.positionABI.Pack("multicall", [][]byte{mintData, refundData})
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack multicall data: %v", err)
+	}
+
+	return signCall(ctx, d.client, opts, &d.deployment.PositionManager, params.ETHAmount, data, "mint")
+}
@@ -0,0 +1,16 @@
+package atomic
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSqrtPriceAtTick(t *testing.T) {
+	for _, tick := range []int64{0, 1, -1, 60, -887220, 887220} {
+		got, _ := sqrtPriceAtTick(tick).Float64()
+		want := math.Pow(1.0001, float64(tick)/2)
+		if math.Abs(got-want)/want > 1e-9 {
+			t.Errorf("sqrtPriceAtTick(%d) = %g, want %g", tick, got, want)
+		}
+	}
+}
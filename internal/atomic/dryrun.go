@@ -0,0 +1,122 @@
+package atomic
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+)
+
+// calldataABIs are the contracts whose calls the dry-run report decodes.
+var calldataABIs = func() []abi.ABI {
+	var parsed []abi.ABI
+	for _, json := range []string{configs.Erc20ABI, configs.RouterABI, configs.V3SwapRouterABI, configs.PositionManagerABI} {
+		contractABI, err := abi.JSON(strings.NewReader(json))
+		if err != nil {
+			panic(fmt.Sprintf("invalid built-in ABI: %v", err))
+		}
+		parsed = append(parsed, contractABI)
+	}
+	return parsed
+}()
+
+// decodeCalldata renders data as method(name=value, ...), expanding multicall batches. Unknown
+// selectors are shown as raw hex.
+func decodeCalldata(data []byte) string {
+	if len(data) < 4 {
+		return hexutil.Encode(data)
+	}
+	for _, contractABI := range calldataABIs {
+		method, err := contractABI.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+		values, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			continue
+		}
+
+		if method.Name == "multicall" {
+			calls := values[0].([][]byte)
+			decoded := make([]string, len(calls))
+			for i, call := range calls {
+				decoded[i] = decodeCalldata(call)
+			}
+			return fmt.Sprintf("multicall[%s]", strings.Join(decoded, "; "))
+		}
+
+		args := make([]string, len(values))
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				value = hexutil.Encode(b)
+			}
+			args[i] = fmt.Sprintf("%s=%v", method.Inputs[i].Name, value)
+		}
+		return fmt.Sprintf("%s(%s)", method.Name, strings.Join(args, ", "))
+	}
+	return hexutil.Encode(data)
+}
+
+// describeLeg decodes what a bundle transaction does.
+func describeLeg(tx *types.Transaction) string {
+	if tx.To() == nil {
+		return fmt.Sprintf("coinbase payment of %s ETH", WeiToEth(tx.Value().String()))
+	}
+	call := decodeCalldata(tx.Data())
+	if tx.Value().Sign() > 0 {
+		call = fmt.Sprintf("%s with %s ETH", call, WeiToEth(tx.Value().String()))
+	}
+	return fmt.Sprintf("%s.%s", tx.To().Hex(), call)
+}
+
+// simulatedOutput decodes the return data of the leg at index with decode.
+func simulatedOutput(sim *flashbot.SimulationResponse, index int, decode func(returnData []byte) (*big.Int, error)) (*big.Int, error) {
+	if index < 0 || index >= len(sim.Result.Results) {
+		return nil, fmt.Errorf("simulation returned %d results, leg %d missing", len(sim.Result.Results), index+1)
+	}
+	returnData, err := hexutil.Decode(sim.Result.Results[index].Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode simulated output: %v", err)
+	}
+	return decode(returnData)
+}
+
+// effectiveSlippage is how far actual fell short of expected, in percent.
+func effectiveSlippage(expected, actual *big.Int) float64 {
+	if expected.Sign() == 0 {
+		return 0
+	}
+	shortfall := new(big.Float).SetInt(new(big.Int).Sub(expected, actual))
+	ratio, _ := new(big.Float).Quo(shortfall, new(big.Float).SetInt(expected)).Float64()
+	return ratio * 100
+}
+
+// reportDryRun prints every leg of the simulated bundle with its decoded calldata and gas, the
+// coinbase diff, and the plan's expected amounts. Nothing is submitted.
+func (r *bundleRunner) reportDryRun(plan *bundlePlan, txs []*types.Transaction, sim *flashbot.SimulationResponse) {
+	log.Println("\n🧪 Dry run report (bundle not submitted)")
+	for i, tx := range txs {
+		log.Printf("   Leg %d %s: nonce %d, gas limit %d", i+1, r.legs.name(i), tx.Nonce(), tx.Gas())
+		log.Printf("      %s", describeLeg(tx))
+		if i < len(sim.Result.Results) {
+			result := sim.Result.Results[i]
+			if result.Error != "" {
+				log.Printf("      simulated: reverted (%s - %s)", result.Error, result.Revert)
+			} else {
+				log.Printf("      simulated: gas used %s, gas fees %s ETH", result.GasUsed, WeiToEth(result.GasFees))
+			}
+		}
+	}
+	log.Printf("   Total gas used: %d, coinbase diff: %s ETH", sim.Result.TotalGasUsed, WeiToEth(sim.Result.CoinbaseDiff))
+
+	if plan.report != nil {
+		plan.report(sim, r.legs)
+	}
+}
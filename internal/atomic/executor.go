@@ -2,23 +2,21 @@ package atomic
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"log"
 	"math/big"
-	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 
 	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
 	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
 )
 
 func formatTokenAmount(amount *big.Int, decimals int) string {
@@ -27,13 +25,12 @@ func formatTokenAmount(amount *big.Int, decimals int) string {
 	return tokenFloat.Text('f', 6)
 }
 
-func getAmountsOut(ctx context.Context, client *ethclient.Client, routerABI *abi.ABI, amountIn *big.Int, path []common.Address) (*big.Int, error) {
+func getAmountsOut(ctx context.Context, client *ethclient.Client, routerAddr common.Address, routerABI *abi.ABI, amountIn *big.Int, path []common.Address) (*big.Int, error) {
 	data, err := routerABI.Pack("getAmountsOut", amountIn, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to pack getAmountsOut: %v", err)
 	}
 
-	routerAddr := common.HexToAddress(configs.UNISWAP_V2_ROUTER_ADDR)
 	result, err := client.CallContract(ctx, ethereum.CallMsg{
 		To:   &routerAddr,
 		Data: data,
@@ -52,152 +49,246 @@ func getAmountsOut(ctx context.Context, client *ethclient.Client, routerABI *abi
 		return nil, fmt.Errorf("invalid amounts returned")
 	}
 
-	return amounts[1], nil
+	return amounts[len(amounts)-1], nil
 }
 
-func monitorBundleInclusion(ctx context.Context, client *ethclient.Client, txs []*types.Transaction, timeout time.Duration) error {
-	log.Printf("⏳ Monitoring bundle inclusion with fast polling (timeout: %v)...", timeout)
-
-	startTime := time.Now()
-	ticker := time.NewTicker(1 * time.Second) // Faster polling for quicker detection
-	defer ticker.Stop()
-
-	txHashes := make([]common.Hash, len(txs))
-	for i, tx := range txs {
-		txHashes[i] = tx.Hash()
-	}
-
-	includedCount := 0
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(timeout):
-			return fmt.Errorf("bundle inclusion timeout after %v (included: %d/%d)", timeout, includedCount, len(txHashes))
-		case <-ticker.C:
-			// Check if any transaction is included
-			newlyIncluded := 0
-			for i, txHash := range txHashes {
-				receipt, err := client.TransactionReceipt(ctx, txHash)
-				if err == nil && receipt != nil && receipt.Status == 1 {
-					if includedCount <= i {
-						log.Printf("✅ Transaction %d included in block %d (status: success)", i+1, receipt.BlockNumber.Uint64())
-						newlyIncluded++
-					}
-					if i+1 > includedCount {
-						includedCount = i + 1
-					}
-				}
-			}
+// reportBundleStats logs the relay's view of each submitted bundle and the signer's reputation,
+// so a failed run shows whether the bundle was simulated, considered or sealed by builders.
+func reportBundleStats(ctx context.Context, fb *flashbot.Client, bundleHashes map[uint64]string) {
+	if len(bundleHashes) == 0 {
+		return
+	}
 
-			// Check if all transactions are included
-			if includedCount == len(txHashes) {
-				log.Printf("🎉 All transactions confirmed! Total time: %v", time.Since(startTime).Truncate(time.Millisecond))
-				return nil
-			}
+	log.Println("📈 Bundle stats report:")
+	var latestTarget uint64
+	for targetBlock, bundleHash := range bundleHashes {
+		if targetBlock > latestTarget {
+			latestTarget = targetBlock
+		}
 
-			// Log progress every 5 seconds
-			elapsed := time.Since(startTime)
-			if elapsed.Truncate(time.Second).Seconds() > 0 && int(elapsed.Seconds())%5 == 0 {
-				log.Printf("⏱️  Monitoring... elapsed: %v, included: %d/%d", elapsed.Truncate(time.Second), includedCount, len(txHashes))
-			}
+		stats, err := fb.GetBundleStats(ctx, bundleHash, targetBlock)
+		if err != nil {
+			log.Printf("   Block %d: failed to fetch bundle stats: %v", targetBlock, err)
+			continue
 		}
+		log.Printf("   Block %d: simulated=%t highPriority=%t consideredBy=%d sealedBy=%d",
+			targetBlock, stats.Result.IsSimulated, stats.Result.IsHighPriority,
+			len(stats.Result.ConsideredByBuildersAt), len(stats.Result.SealedByBuildersAt))
+	}
+
+	userStats, err := fb.GetUserStats(ctx, latestTarget)
+	if err != nil {
+		log.Printf("   Failed to fetch user stats: %v", err)
+		return
 	}
+	log.Printf("   Reputation: highPriority=%t, 7d validator payments=%s ETH, 7d gas simulated=%s",
+		userStats.Result.IsHighPriority, WeiToEth(userStats.Result.Last7dValidatorPayments), userStats.Result.Last7dGasSimulated)
 }
 
-func ExecuteAtomicOperations(ctx context.Context, client *ethclient.Client, config *configs.Config, eoaKey, flashbotsKey *ecdsa.PrivateKey, chainID *big.Int, nonce uint64, gasParams *GasParams) error {
-	eoaAddress := crypto.PubkeyToAddress(eoaKey.PublicKey)
-	deadline := big.NewInt(time.Now().Unix() + config.DeadlineSeconds)
+// addLiquidityLeg names the zap's deposit leg.
+const addLiquidityLeg = "addLiquidity"
 
-	// Parse ABIs
-	routerContractABI, err := abi.JSON(strings.NewReader(configs.RouterABI))
+// verifySimulatedSwap decodes the swap leg's return data from the eth_callBundle results and checks
+// that the tokens actually received cover what the approve and liquidity legs will pull.
+func verifySimulatedSwap(simResult *flashbot.SimulationResponse, swapIndex int, dex DEX, tokenAmountNeeded *big.Int) (*big.Int, error) {
+	if swapIndex >= len(simResult.Result.Results) {
+		return nil, fmt.Errorf("simulation returned %d results, swap leg missing", len(simResult.Result.Results))
+	}
+
+	returnData, err := hexutil.Decode(simResult.Result.Results[swapIndex].Value)
 	if err != nil {
-		return fmt.Errorf("failed to parse router ABI: %v", err)
+		return nil, fmt.Errorf("failed to decode simulated swap output: %v", err)
 	}
 
-	erc20ContractABI, err := abi.JSON(strings.NewReader(configs.Erc20ABI))
+	received, err := dex.SwapOutput(returnData)
 	if err != nil {
-		return fmt.Errorf("failed to parse ERC20 ABI: %v", err)
+		return nil, fmt.Errorf("failed to read simulated swap output: %v", err)
+	}
+	if received.Cmp(tokenAmountNeeded) < 0 {
+		return received, fmt.Errorf("simulated swap delivers %s tokens, liquidity leg needs %s", received, tokenAmountNeeded)
 	}
+	return received, nil
+}
 
-	// ✅ Split initial ETH: 50% for swap, 50% for liquidity
-	two := big.NewInt(2)
-	ethForSwap := new(big.Int).Div(config.EthAmount, two)
-	// Use the remaining ETH for LP to avoid dust from division
-	ethForLP := new(big.Int).Sub(config.EthAmount, ethForSwap)
+func ExecuteAtomicOperations(ctx context.Context, fb *flashbot.Client, config *configs.Config, eoa signer.Signer, chainID *big.Int, nonces *NonceManager, gasParams *GasParams) error {
+	client := fb.Eth()
+	eoaAddress := eoa.Address()
+	deadline := big.NewInt(time.Now().Unix() + config.DeadlineSeconds)
 
-	// 1. Calculate token output from swapping HALF the ETH
-	log.Println("\n[1/5] Calculating expected token output...")
-	path := []common.Address{common.HexToAddress(configs.WETH_ADDRESS), config.TokenAddress}
-	expectedTokenAmount, err := getAmountsOut(ctx, client, &routerContractABI, ethForSwap, path)
+	dex, err := NewDEX(client, config)
 	if err != nil {
-		return fmt.Errorf("failed to get expected token amount: %v", err)
+		return err
 	}
-	log.Printf("Expected token output: %s", formatTokenAmount(expectedTokenAmount, 6))
 
-	// 2. Create token approval transaction
-	log.Println("\n[2/5] Creating token approval transaction...")
-	approveTx, err := createApproveTransaction(ctx, client, eoaKey, chainID, nonce, gasParams, config.TokenAddress, expectedTokenAmount, &erc20ContractABI)
+	tokens, err := NewTokenRegistry(client)
 	if err != nil {
-		return fmt.Errorf("failed to create approve transaction: %v", err)
+		return err
 	}
-	log.Printf("Approve TX hash: %s (Gas: %d)", approveTx.Hash().Hex(), approveTx.Gas())
 
-	// 3. Create swap transaction with ethForSwap
-	log.Println("\n[3/5] Creating swap transaction...")
-	amountOutMin := applySlippage(expectedTokenAmount, config.SlippageTolerance)
-	swapTx, err := createSwapTransaction(ctx, client, eoaKey, chainID, eoaAddress, nonce+1, gasParams, deadline, ethForSwap, amountOutMin, path, &routerContractABI)
+	// Paying with an ERC-20 adds an approve and a swap to ETH in front of the zap
+	steps := 5
+	var inputQuote *inputSwapQuote
+	ethAmount := config.EthAmount
+	if config.PaysWithToken() {
+		steps = 7
+		inputToken, err := tokens.Info(ctx, config.InputToken)
+		if err != nil {
+			return err
+		}
+		balance, err := tokens.BalanceOf(ctx, config.InputToken, eoaAddress)
+		if err != nil {
+			return fmt.Errorf("failed to read input token balance: %v", err)
+		}
+		if balance.Cmp(config.InputAmount) < 0 {
+			return fmt.Errorf("input amount %s exceeds balance %s", inputToken.Format(config.InputAmount), inputToken.Format(balance))
+		}
+		inputQuote, err = quoteInputSwap(ctx, dex, tokens, config)
+		if err != nil {
+			return err
+		}
+		ethAmount = inputQuote.ETHMin
+	}
+
+	// 1. Size the swap from the pool so the deposit matches the post-swap pool ratio
+	log.Printf("\n[1/%d] Calculating optimal swap amount and expected token output...", steps)
+	quote, err := quoteZap(ctx, client, dex, tokens, config.PathBaseTokens, config.TokenAddress, eoaAddress, ethAmount, config.SlippageTolerance)
 	if err != nil {
-		return fmt.Errorf("failed to create swap transaction: %v", err)
+		return err
 	}
-	log.Printf("Swap TX hash: %s (Gas: %d)", swapTx.Hash().Hex(), swapTx.Gas())
 
-	// 4. Create add liquidity transaction with ethForLP
-	log.Println("\n[4/5] Creating add liquidity transaction...")
-	addLiquidityTx, err := createAddLiquidityTransaction(ctx, client, eoaKey, chainID, eoaAddress, nonce+2, gasParams, deadline, config.TokenAddress, expectedTokenAmount, ethForLP, config.SlippageTolerance, &routerContractABI)
+	// Lock the account's nonces for the lifetime of the bundle
+	lease, err := nonces.Acquire(ctx, eoaAddress)
 	if err != nil {
-		return fmt.Errorf("failed to create add liquidity transaction: %v", err)
+		return err
 	}
-	log.Printf("AddLiquidity TX hash: %s (Gas: %d)", addLiquidityTx.Hash().Hex(), addLiquidityTx.Gas())
+	defer lease.Release()
+
+	// 2-4. Create approve, swap and add liquidity transactions. The plan's legs are rebuilt
+	// with fresh gas parameters when the base fee outruns MaxFeePerGas, and with a fresh
+	// quote when the pool moves between blocks.
+	runner := &bundleRunner{fb: fb, config: config, eoa: eoa, chainID: chainID, lease: lease, deadline: deadline}
+	plan := &bundlePlan{
+		steps: steps,
+		legs: func(b *legBuilder) error {
+			step := 2
+			if inputQuote != nil {
+				log.Printf("\n[%d/%d] Creating input token approval transaction...", step, steps)
+				if err := b.approve(ctx, tokens, "approveInput", config.InputToken, dex.SwapSpender(), inputQuote.AmountIn); err != nil {
+					return err
+				}
 
-	// 5. Bundle and send via Flashbots
-	log.Println("\n[5/5] Bundling and sending to Flashbots...")
-	transactions := []*types.Transaction{approveTx, swapTx, addLiquidityTx}
+				log.Printf("\n[%d/%d] Creating input swap transaction...", step+1, steps)
+				inputSwapTx, err := dex.BuildSwap(ctx, b.opts(), SwapParams{
+					AmountIn:     inputQuote.AmountIn,
+					AmountOutMin: inputQuote.ETHMin,
+					Path:         inputQuote.Path,
+					ETHOut:       true,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to create input swap transaction: %v", err)
+				}
+				log.Printf("Input swap TX hash: %s (Gas: %d)", inputSwapTx.Hash().Hex(), inputSwapTx.Gas())
+				b.add("inputSwap", inputSwapTx, false)
+				step += 2
+			}
 
-	// Calculate total gas fees
-	totalGasUsed := approveTx.Gas() + swapTx.Gas() + addLiquidityTx.Gas()
-	var totalFees *big.Int
-	if gasParams.IsLegacy {
-		totalFees = new(big.Int).Mul(gasParams.LegacyGasPrice, new(big.Int).SetUint64(totalGasUsed))
-	} else {
-		totalFees = new(big.Int).Mul(gasParams.MaxFeePerGas, new(big.Int).SetUint64(totalGasUsed))
-	}
-	log.Printf("📊 Bundle Stats: Total Gas=%d, Est. Fees=~%s ETH", totalGasUsed, WeiToEth(totalFees.String()))
+			log.Printf("\n[%d/%d] Creating token approval transaction...", step, steps)
+			if err := b.approve(ctx, tokens, "approve", config.TokenAddress, dex.LiquiditySpender(), quote.LiquidityTokenAmount); err != nil {
+				return err
+			}
 
-	// Simulate bundle first
-	simResult, err := flashbot.SimulateBundle(ctx, transactions, flashbotsKey)
-	if err != nil {
-		log.Printf("⚠️  Bundle simulation failed: %v", err)
-	} else if simResult.Error != nil {
-		return fmt.Errorf("bundle simulation returned an error: %s", simResult.Error.Message)
-	} else {
-		log.Println("✅ Bundle simulation successful!")
-		for i, result := range simResult.Result.Results {
-			if result.Error != "" {
-				return fmt.Errorf("transaction %d simulation error: %s - %s", i+1, result.Error, result.Revert)
+			log.Printf("\n[%d/%d] Creating swap transaction...", step+1, steps)
+			swapTx, err := dex.BuildSwap(ctx, b.opts(), SwapParams{
+				AmountIn:      quote.EthForSwap,
+				AmountOutMin:  quote.swapMin(),
+				Path:          quote.Path,
+				ETHIn:         true,
+				FeeOnTransfer: quote.FeeOnTransfer,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create swap transaction: %v", err)
 			}
-			log.Printf("   TX %d: Gas used %s, Gas fees %s ETH", i+1, result.GasUsed, WeiToEth(result.GasFees))
-		}
-	}
+			log.Printf("Swap TX hash: %s (Gas: %d)", swapTx.Hash().Hex(), swapTx.Gas())
+			b.add(swapLeg, swapTx, false)
 
-	// Send bundle with retries for better inclusion chance
-	sendResult, err := flashbot.SendBundleWithRetries(ctx, transactions, flashbotsKey, 3)
-	if err != nil {
-		return fmt.Errorf("failed to send bundle: %v", err)
+			log.Printf("\n[%d/%d] Creating add liquidity transaction...", step+2, steps)
+			addLiquidityTx, err := dex.BuildAddLiquidity(ctx, b.opts(), LiquidityParams{
+				Token:       config.TokenAddress,
+				TokenAmount: quote.LiquidityTokenAmount,
+				TokenMin:    applySlippage(quote.LiquidityTokenAmount, config.SlippageTolerance),
+				ETHAmount:   quote.EthForLP,
+				ETHMin:      quote.AmountETHMin,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create add liquidity transaction: %v", err)
+			}
+			log.Printf("AddLiquidity TX hash: %s (Gas: %d)", addLiquidityTx.Hash().Hex(), addLiquidityTx.Gas())
+			b.add(addLiquidityLeg, addLiquidityTx, false)
+			return nil
+		},
+		surplus: func(simResult *flashbot.SimulationResponse, legs *legBuilder) (*big.Int, error) {
+			if quote.FeeOnTransfer {
+				return nil, fmt.Errorf("the fee-on-transfer swap returns no output to measure a surplus from")
+			}
+			received, err := simulatedOutput(simResult, legs.index(swapLeg), dex.SwapOutput)
+			if err != nil {
+				return nil, err
+			}
+			return quote.surplus(received), nil
+		},
+		guard: func(bribe *big.Int) {
+			quote.guard(bribe)
+		},
+		verify: func(simResult *flashbot.SimulationResponse, legs *legBuilder) error {
+			if quote.FeeOnTransfer {
+				// The fee-on-transfer swap returns nothing; the router itself reverts unless the
+				// balance received covers AmountOutMin, which bounds the liquidity leg.
+				log.Printf("   Simulated fee-on-transfer swap passed its %s minimum (liquidity leg uses %s)", quote.Token.Format(quote.AmountOutMin), quote.Token.Format(quote.LiquidityTokenAmount))
+				return nil
+			}
+			received, err := verifySimulatedSwap(simResult, legs.index(swapLeg), dex, quote.LiquidityTokenAmount)
+			if err != nil {
+				return err
+			}
+			log.Printf("   Simulated swap output: %s (liquidity leg uses %s)", quote.Token.Format(received), quote.Token.Format(quote.LiquidityTokenAmount))
+			return nil
+		},
+		report: func(simResult *flashbot.SimulationResponse, legs *legBuilder) {
+			log.Printf("   Swap: %s ETH for ~%s (minimum %s)", WeiToEth(quote.EthForSwap.String()), quote.Token.Format(quote.NetTokenAmount), quote.Token.Format(quote.AmountOutMin))
+			if !quote.FeeOnTransfer {
+				if received, err := simulatedOutput(simResult, legs.index(swapLeg), dex.SwapOutput); err == nil {
+					log.Printf("   Simulated swap output: %s, effective slippage %.2f%%", quote.Token.Format(received), effectiveSlippage(quote.NetTokenAmount, received))
+				}
+			}
+			log.Printf("   Liquidity: %s + %s ETH (minimum %s + %s ETH)", quote.Token.Format(quote.LiquidityTokenAmount), WeiToEth(quote.EthForLP.String()),
+				quote.Token.Format(applySlippage(quote.LiquidityTokenAmount, config.SlippageTolerance)), WeiToEth(quote.AmountETHMin.String()))
+			if liquidity, err := simulatedOutput(simResult, legs.index(addLiquidityLeg), dex.LiquidityOutput); err == nil {
+				log.Printf("   Simulated liquidity minted: %s units on %s", liquidity, dex.Name())
+			} else {
+				log.Printf("   Simulated liquidity unavailable: %v", err)
+			}
+		},
+		requote: func(ctx context.Context) (bool, error) {
+			stale, err := quote.stale(ctx, dex, config.RequoteBps)
+			if err != nil || !stale {
+				return false, err
+			}
+			if inputQuote != nil {
+				freshInputQuote, err := quoteInputSwap(ctx, dex, tokens, config)
+				if err != nil {
+					return false, err
+				}
+				inputQuote = freshInputQuote
+				ethAmount = inputQuote.ETHMin
+			}
+			freshQuote, err := quoteZap(ctx, client, dex, tokens, config.PathBaseTokens, config.TokenAddress, eoaAddress, ethAmount, config.SlippageTolerance)
+			if err != nil {
+				return false, err
+			}
+			quote = freshQuote
+			return true, nil
+		},
 	}
 
-	log.Printf("🎯 Bundle submitted! Hash: %s", sendResult.Result.BundleHash)
-
-	// Monitor for inclusion with faster polling
-	return monitorBundleInclusion(ctx, client, transactions, 60*time.Second)
+	return runner.run(ctx, plan, gasParams)
 }
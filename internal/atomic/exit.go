@@ -0,0 +1,382 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
+)
+
+// exitQuote holds the amounts of a full position exit derived from one snapshot of the pair.
+// Reserves are ordered token-in, so ReserveIn is the token side and ReserveOut the WETH side.
+type exitQuote struct {
+	Token          *TokenInfo
+	Reserves       *PairReserves
+	Liquidity      *big.Int
+	TotalSupply    *big.Int
+	ExpectedToken  *big.Int
+	ExpectedETH    *big.Int
+	AmountTokenMin *big.Int
+	AmountETHMin   *big.Int
+	SwapAmountIn   *big.Int
+	SwapAmountOut  *big.Int
+	SwapOutMin     *big.Int
+	// FeeOnTransfer marks a token that charges a fee on transfer. TransferReceived is what
+	// arrives of ExpectedToken sent in one transfer, the fee rate every hop is priced at.
+	FeeOnTransfer    bool
+	TransferReceived *big.Int
+	// Bribe is the coinbase bribe added to the swap minimum.
+	Bribe *big.Int
+}
+
+// quoteExit values the owner's whole LP balance at the current reserves. Until the bundle is
+// simulated the swap sells the removal's token minimum as it reaches the wallet, which it can
+// never lack; sizeSwap then reprices it against the simulated removal. A fee-on-transfer
+// token reaches the wallet through the router, so its fee is charged twice on the way out.
+func quoteExit(ctx context.Context, client *ethclient.Client, dex *UniswapV2, tokens *TokenRegistry, tokenAddr, owner common.Address, slippage float64) (*exitQuote, error) {
+	pairABI, err := abi.JSON(strings.NewReader(configs.PairABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pair ABI: %v", err)
+	}
+
+	token, err := tokens.Info(ctx, tokenAddr)
+	if err != nil {
+		return nil, err
+	}
+	reserves, err := dex.Reserves(ctx, tokenAddr, dex.WETH())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pair reserves: %v", err)
+	}
+	lpToken, err := tokens.Info(ctx, reserves.Pair)
+	if err != nil {
+		return nil, err
+	}
+
+	liquidity, err := tokens.BalanceOf(ctx, reserves.Pair, owner)
+	if err != nil {
+		return nil, err
+	}
+	if liquidity.Sign() == 0 {
+		return nil, fmt.Errorf("%s holds no liquidity in pair %s", owner.Hex(), reserves.Pair.Hex())
+	}
+
+	values, err := callView(ctx, client, &pairABI, reserves.Pair, "totalSupply")
+	if err != nil {
+		return nil, err
+	}
+	totalSupply := values[0].(*big.Int)
+
+	expectedToken := new(big.Int).Mul(liquidity, reserves.ReserveIn)
+	expectedToken.Div(expectedToken, totalSupply)
+	expectedETH := new(big.Int).Mul(liquidity, reserves.ReserveOut)
+	expectedETH.Div(expectedETH, totalSupply)
+	log.Printf("Pair %s: removing %s for ~%s + %s ETH", reserves.Pair.Hex(), lpToken.Format(liquidity), token.Format(expectedToken), WeiToEth(expectedETH.String()))
+
+	quote := &exitQuote{
+		Token:            token,
+		Reserves:         reserves,
+		Liquidity:        liquidity,
+		TotalSupply:      totalSupply,
+		ExpectedToken:    expectedToken,
+		ExpectedETH:      expectedETH,
+		AmountTokenMin:   applySlippage(expectedToken, slippage),
+		AmountETHMin:     applySlippage(expectedETH, slippage),
+		TransferReceived: expectedToken,
+	}
+
+	// The router pays the burned tokens out, so probe the pair's transfer to it
+	received, err := simulateTransfer(ctx, client, tokenAddr, reserves.Pair, dex.Router(), expectedToken)
+	if err != nil {
+		log.Printf("⚠️  Could not check for transfer fees, assuming a standard token: %v", err)
+	} else if received.Cmp(expectedToken) < 0 {
+		quote.FeeOnTransfer = true
+		quote.TransferReceived = received
+		feeBps := new(big.Int).Sub(expectedToken, received)
+		feeBps.Mul(feeBps, big.NewInt(10000)).Div(feeBps, expectedToken)
+		log.Printf("🧾 Fee-on-transfer token detected: %.2f%% fee, net removal ~%s", float64(feeBps.Int64())/100, token.Format(quote.walletAmount(expectedToken)))
+	}
+
+	quote.priceSwap(quote.walletAmount(quote.AmountTokenMin), expectedToken, expectedETH, slippage)
+	log.Printf("Swapping at least %s back for ~%s ETH (min %s ETH)", token.Format(quote.SwapAmountIn), WeiToEth(quote.SwapAmountOut.String()), WeiToEth(quote.SwapOutMin.String()))
+	return quote, nil
+}
+
+// afterTransfer is what arrives of amount sent in one transfer of the token.
+func (q *exitQuote) afterTransfer(amount *big.Int) *big.Int {
+	if !q.FeeOnTransfer {
+		return amount
+	}
+	received := new(big.Int).Mul(amount, q.TransferReceived)
+	return received.Div(received, q.ExpectedToken)
+}
+
+// walletAmount is what reaches the wallet of amountToken burned by the removal: the pair pays
+// it to the router and the router on to the wallet.
+func (q *exitQuote) walletAmount(amountToken *big.Int) *big.Int {
+	return q.afterTransfer(q.afterTransfer(amountToken))
+}
+
+// priceSwap makes the swap leg sell amountIn against the pair as left by a removal of
+// amountToken and amountETH. The pair only receives amountIn net of the transfer fee.
+func (q *exitQuote) priceSwap(amountIn, amountToken, amountETH *big.Int, slippage float64) {
+	reserveToken := new(big.Int).Sub(q.Reserves.ReserveIn, amountToken)
+	reserveETH := new(big.Int).Sub(q.Reserves.ReserveOut, amountETH)
+	q.SwapAmountIn = amountIn
+	q.SwapAmountOut = getAmountOut(q.afterTransfer(amountIn), reserveToken, reserveETH)
+	q.SwapOutMin = applySlippage(q.SwapAmountOut, slippage)
+}
+
+// stale reports whether the submitted bundle no longer holds at the current reserves: the
+// removal would return less than its minimums or than the swap sells, the swap would return
+// less than its minimum, or either reserve moved by more than requoteBps basis points.
+func (q *exitQuote) stale(current *PairReserves, requoteBps uint64) bool {
+	amountToken := new(big.Int).Mul(q.Liquidity, current.ReserveIn)
+	amountToken.Div(amountToken, q.TotalSupply)
+	amountETH := new(big.Int).Mul(q.Liquidity, current.ReserveOut)
+	amountETH.Div(amountETH, q.TotalSupply)
+	if amountToken.Cmp(q.AmountTokenMin) < 0 || amountETH.Cmp(q.AmountETHMin) < 0 || q.walletAmount(amountToken).Cmp(q.SwapAmountIn) < 0 {
+		return true
+	}
+
+	reserveToken := new(big.Int).Sub(current.ReserveIn, amountToken)
+	reserveETH := new(big.Int).Sub(current.ReserveOut, amountETH)
+	if getAmountOut(q.afterTransfer(q.SwapAmountIn), reserveToken, reserveETH).Cmp(q.swapMin()) < 0 {
+		return true
+	}
+	return movedBeyond(q.Reserves.ReserveIn, current.ReserveIn, requoteBps) || movedBeyond(q.Reserves.ReserveOut, current.ReserveOut, requoteBps)
+}
+
+// sizeSwap sizes the swap leg from amountToken and amountETH, the simulated removal output. It
+// sells the slippage floor of amountToken, capped at the removal's token minimum, so a pair that
+// moves within tolerance before inclusion still returns every token the swap pulls; the rest
+// stays in the wallet as dust. It reports whether the swap changed.
+func (q *exitQuote) sizeSwap(amountToken, amountETH *big.Int, slippage float64) bool {
+	amountIn := applySlippage(amountToken, slippage)
+	if amountIn.Cmp(q.AmountTokenMin) > 0 {
+		amountIn = q.AmountTokenMin
+	}
+	if amountIn.Cmp(q.SwapAmountIn) == 0 {
+		return false
+	}
+	q.priceSwap(amountIn, amountToken, amountETH, slippage)
+	log.Printf("Swap sized from the simulated removal: %s for ~%s ETH (min %s ETH)", q.Token.Format(q.SwapAmountIn), WeiToEth(q.SwapAmountOut.String()), WeiToEth(q.SwapOutMin.String()))
+	return true
+}
+
+// swapMin is the swap leg's minimum ETH output: the slippage floor plus any bribe, so a swap
+// that cannot pay the builder out of its surplus reverts.
+func (q *exitQuote) swapMin() *big.Int {
+	if q.Bribe == nil {
+		return q.SwapOutMin
+	}
+	return new(big.Int).Add(q.SwapOutMin, q.Bribe)
+}
+
+// removeLiquidityLeg names the leg whose return data verifySimulatedRemoval checks.
+const removeLiquidityLeg = "removeLiquidity"
+
+// simulatedRemoval decodes the token and ETH amounts from the removal's return data. The
+// fee-on-transfer removal only returns the ETH amount, so its token amount is nil.
+func simulatedRemoval(simResult *flashbot.SimulationResponse, removeIndex int, routerABI *abi.ABI, feeOnTransfer bool) (*big.Int, *big.Int, error) {
+	if removeIndex < 0 || removeIndex >= len(simResult.Result.Results) {
+		return nil, nil, fmt.Errorf("simulation returned %d results, remove liquidity leg missing", len(simResult.Result.Results))
+	}
+	result := simResult.Result.Results[removeIndex]
+	if result.Error != "" {
+		return nil, nil, fmt.Errorf("simulated removal failed: %s - %s", result.Error, result.Revert)
+	}
+
+	returnData, err := hexutil.Decode(result.Value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode simulated removal output: %v", err)
+	}
+
+	values, err := routerABI.Unpack(removeLiquidityMethod(feeOnTransfer), returnData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unpack simulated removal amounts: %v", err)
+	}
+	if feeOnTransfer {
+		return nil, values[0].(*big.Int), nil
+	}
+	return values[0].(*big.Int), values[1].(*big.Int), nil
+}
+
+// verifySimulatedRemoval decodes the removal's return data and checks that the tokens returned
+// cover what the swap leg will sell. The fee-on-transfer removal reports no token amount; the
+// router checks its gross minimum and the swap sells no more than that nets in the wallet.
+func verifySimulatedRemoval(simResult *flashbot.SimulationResponse, removeIndex int, routerABI *abi.ABI, feeOnTransfer bool, tokenAmountNeeded *big.Int) (*big.Int, *big.Int, error) {
+	amountToken, amountETH, err := simulatedRemoval(simResult, removeIndex, routerABI, feeOnTransfer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if amountToken != nil && amountToken.Cmp(tokenAmountNeeded) < 0 {
+		return amountToken, amountETH, fmt.Errorf("simulated removal returns %s tokens, swap leg sells %s", amountToken, tokenAmountNeeded)
+	}
+	return amountToken, amountETH, nil
+}
+
+// ExecuteExitOperations is the reverse of ExecuteAtomicOperations: it removes the EOA's whole
+// liquidity position and swaps the returned tokens back to ETH in one bundle. It needs the LP
+// token of a V2-style pair, so it only runs on V2 forks.
+func ExecuteExitOperations(ctx context.Context, fb *flashbot.Client, config *configs.Config, eoa signer.Signer, chainID *big.Int, nonces *NonceManager, gasParams *GasParams) error {
+	client := fb.Eth()
+	eoaAddress := eoa.Address()
+	deadline := big.NewInt(time.Now().Unix() + config.DeadlineSeconds)
+
+	selected, err := NewDEX(client, config)
+	if err != nil {
+		return err
+	}
+	dex, ok := selected.(*UniswapV2)
+	if !ok {
+		return fmt.Errorf("exit operation is not supported on %s", selected.Name())
+	}
+
+	tokens, err := NewTokenRegistry(client)
+	if err != nil {
+		return err
+	}
+
+	// Parse ABIs
+	routerContractABI, err := abi.JSON(strings.NewReader(configs.RouterABI))
+	if err != nil {
+		return fmt.Errorf("failed to parse router ABI: %v", err)
+	}
+
+	// 1. Value the LP position and the swap back to ETH
+	log.Println("\n[1/6] Calculating position value and expected ETH output...")
+	quote, err := quoteExit(ctx, client, dex, tokens, config.TokenAddress, eoaAddress, config.SlippageTolerance)
+	if err != nil {
+		return err
+	}
+	path := []common.Address{config.TokenAddress, dex.WETH()}
+
+	// Lock the account's nonces for the lifetime of the bundle
+	lease, err := nonces.Acquire(ctx, eoaAddress)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	// 2-5. Create LP approve, remove liquidity, token approve and swap transactions
+	runner := &bundleRunner{fb: fb, config: config, eoa: eoa, chainID: chainID, lease: lease, deadline: deadline}
+	plan := &bundlePlan{
+		steps: 6,
+		legs: func(b *legBuilder) error {
+			log.Println("\n[2/6] Creating LP token approval transaction...")
+			if err := b.approve(ctx, tokens, "approveLP", quote.Reserves.Pair, dex.Router(), quote.Liquidity); err != nil {
+				return err
+			}
+
+			log.Println("\n[3/6] Creating remove liquidity transaction...")
+			removeTx, err := dex.BuildRemoveLiquidity(ctx, b.opts(), config.TokenAddress, quote.Liquidity, quote.AmountTokenMin, quote.AmountETHMin, quote.FeeOnTransfer)
+			if err != nil {
+				return fmt.Errorf("failed to create remove liquidity transaction: %v", err)
+			}
+			log.Printf("RemoveLiquidity TX hash: %s (Gas: %d)", removeTx.Hash().Hex(), removeTx.Gas())
+			b.add(removeLiquidityLeg, removeTx, false)
+
+			log.Println("\n[4/6] Creating token approval transaction...")
+			if err := b.approve(ctx, tokens, "approve", config.TokenAddress, dex.SwapSpender(), quote.SwapAmountIn); err != nil {
+				return err
+			}
+
+			log.Println("\n[5/6] Creating swap transaction...")
+			swapTx, err := dex.BuildSwap(ctx, b.opts(), SwapParams{
+				AmountIn:      quote.SwapAmountIn,
+				AmountOutMin:  quote.swapMin(),
+				Path:          path,
+				ETHOut:        true,
+				FeeOnTransfer: quote.FeeOnTransfer,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create swap transaction: %v", err)
+			}
+			log.Printf("Swap TX hash: %s (Gas: %d)", swapTx.Hash().Hex(), swapTx.Gas())
+			b.add(swapLeg, swapTx, false)
+			return nil
+		},
+		size: func(simResult *flashbot.SimulationResponse, legs *legBuilder) (bool, error) {
+			amountToken, amountETH, err := simulatedRemoval(simResult, legs.index(removeLiquidityLeg), &routerContractABI, quote.FeeOnTransfer)
+			if err != nil {
+				return false, err
+			}
+			if amountToken == nil {
+				// Nothing to size from; the swap keeps selling the removal's net minimum
+				return false, nil
+			}
+			return quote.sizeSwap(amountToken, amountETH, config.SlippageTolerance), nil
+		},
+		surplus: func(simResult *flashbot.SimulationResponse, legs *legBuilder) (*big.Int, error) {
+			if quote.FeeOnTransfer {
+				return nil, fmt.Errorf("the fee-on-transfer swap returns no output to measure a surplus from")
+			}
+			received, err := simulatedOutput(simResult, legs.index(swapLeg), dex.SwapOutput)
+			if err != nil {
+				return nil, err
+			}
+			surplus := new(big.Int).Sub(received, quote.SwapOutMin)
+			if surplus.Sign() < 0 {
+				surplus.SetInt64(0)
+			}
+			return surplus, nil
+		},
+		guard: func(bribe *big.Int) {
+			quote.Bribe = bribe
+		},
+		verify: func(simResult *flashbot.SimulationResponse, legs *legBuilder) error {
+			amountToken, amountETH, err := verifySimulatedRemoval(simResult, legs.index(removeLiquidityLeg), &routerContractABI, quote.FeeOnTransfer, quote.SwapAmountIn)
+			if err != nil {
+				return err
+			}
+			if amountToken == nil {
+				log.Printf("   Simulated fee-on-transfer removal output: %s ETH (swap leg sells %s)", WeiToEth(amountETH.String()), quote.Token.Format(quote.SwapAmountIn))
+				return nil
+			}
+			log.Printf("   Simulated removal output: %s + %s ETH (swap leg sells %s)", quote.Token.Format(amountToken), WeiToEth(amountETH.String()), quote.Token.Format(quote.SwapAmountIn))
+			return nil
+		},
+		report: func(simResult *flashbot.SimulationResponse, legs *legBuilder) {
+			log.Printf("   Removal: ~%s + %s ETH (minimum %s + %s ETH)", quote.Token.Format(quote.ExpectedToken), WeiToEth(quote.ExpectedETH.String()),
+				quote.Token.Format(quote.AmountTokenMin), WeiToEth(quote.AmountETHMin.String()))
+			if amountToken, amountETH, err := verifySimulatedRemoval(simResult, legs.index(removeLiquidityLeg), &routerContractABI, quote.FeeOnTransfer, quote.SwapAmountIn); err == nil && amountToken != nil {
+				log.Printf("   Simulated removal: %s + %s ETH, effective slippage %.2f%% / %.2f%%", quote.Token.Format(amountToken), WeiToEth(amountETH.String()),
+					effectiveSlippage(quote.ExpectedToken, amountToken), effectiveSlippage(quote.ExpectedETH, amountETH))
+			}
+			log.Printf("   Swap: %s for ~%s ETH (minimum %s ETH)", quote.Token.Format(quote.SwapAmountIn), WeiToEth(quote.SwapAmountOut.String()), WeiToEth(quote.SwapOutMin.String()))
+			if !quote.FeeOnTransfer {
+				if received, err := simulatedOutput(simResult, legs.index(swapLeg), dex.SwapOutput); err == nil {
+					log.Printf("   Simulated swap output: %s ETH, effective slippage %.2f%%", WeiToEth(received.String()), effectiveSlippage(quote.SwapAmountOut, received))
+				}
+			}
+		},
+		requote: func(ctx context.Context) (bool, error) {
+			reserves, err := dex.Reserves(ctx, path[0], path[1])
+			if err != nil {
+				return false, err
+			}
+			if !quote.stale(reserves, config.RequoteBps) {
+				return false, nil
+			}
+			freshQuote, err := quoteExit(ctx, client, dex, tokens, config.TokenAddress, eoaAddress, config.SlippageTolerance)
+			if err != nil {
+				return false, err
+			}
+			quote = freshQuote
+			return true, nil
+		},
+	}
+
+	return runner.run(ctx, plan, gasParams)
+}
@@ -0,0 +1,84 @@
+package atomic_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/atomic"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/testchain"
+)
+
+func TestExitSellsTheRemovalBarDust(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+	tokens := chain.TokenBalance(t, chain.EOA())
+	reserve := chain.TokenBalance(t, testchain.PairAddress(testchain.TokenAddress, testchain.WETHAddress))
+	balance, err := chain.Client.BalanceAt(context.Background(), chain.EOA(), nil)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+
+	config.Operation = configs.OPERATION_EXIT
+	if err := run(t, chain, config, atomic.ExecuteExitOperations); err != nil {
+		t.Fatalf("exit failed: %v", err)
+	}
+
+	if lp := chain.LPBalance(t, chain.EOA()); lp.Sign() != 0 {
+		t.Errorf("expected the exit to burn every LP token, %s left", lp)
+	}
+	// The swap sells the removal's slippage floor and leaves the rest as dust, a fraction of
+	// the position's share of the reserve
+	left := chain.TokenBalance(t, chain.EOA())
+	dust := new(big.Int).Sub(left, tokens)
+	if dust.Sign() < 0 || new(big.Int).Mul(dust, big.NewInt(100)).Cmp(reserve) > 0 {
+		t.Errorf("expected the removed tokens to be sold bar dust, token balance went from %s to %s", tokens, left)
+	}
+	after, err := chain.Client.BalanceAt(context.Background(), chain.EOA(), nil)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+	if after.Cmp(balance) <= 0 {
+		t.Errorf("expected the exit to return ETH, balance went from %s to %s", balance, after)
+	}
+}
+
+func TestExitFeeOnTransferPosition(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	config.TokenAddress = testchain.FeeTokenAddress
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+	balance, err := chain.Client.BalanceAt(context.Background(), chain.EOA(), nil)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+
+	config.Operation = configs.OPERATION_EXIT
+	if err := run(t, chain, config, atomic.ExecuteExitOperations); err != nil {
+		t.Fatalf("exit failed: %v", err)
+	}
+
+	pool := testchain.PairAddress(testchain.FeeTokenAddress, testchain.WETHAddress)
+	if lp := chain.BalanceOf(t, pool, chain.EOA()); lp.Sign() != 0 {
+		t.Errorf("expected the exit to burn every LP token, %s left", lp)
+	}
+	after, err := chain.Client.BalanceAt(context.Background(), chain.EOA(), nil)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+	if after.Cmp(balance) <= 0 {
+		t.Errorf("expected the exit to return ETH, balance went from %s to %s", balance, after)
+	}
+}
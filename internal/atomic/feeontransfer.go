@@ -0,0 +1,44 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// transferProbeCode is installed over the sender with an eth_call state override. Called with
+// (token, recipient, amount) as three calldata words it runs token.transfer(recipient, amount)
+// and returns the recipient's balance increase, reverting if any of the calls fail:
+//
+//	before = balanceOf(recipient); transfer(recipient, amount); return balanceOf(recipient) - before
+var transferProbeCode = common.FromHex("0x6370a0823160e01b5f526020356004526020608060245f5f355afa15606f5763a9059cbb60e01b5f526020356004526040356024525f5f60445f5f5f355af115606f576370a0823160e01b5f52602035600452602060a060245f5f355afa15606f5760805160a051035f5260205ff35b5f5ffd")
+
+// simulateTransfer returns how many tokens recipient receives when from transfers amount to it.
+// The sender keeps its token balance, only its code is replaced for the call, so simulating a
+// transfer out of the pair reproduces the buy-side tax of fee-on-transfer tokens.
+func simulateTransfer(ctx context.Context, client *ethclient.Client, token, from, recipient common.Address, amount *big.Int) (*big.Int, error) {
+	input := make([]byte, 0, 96)
+	input = append(input, common.LeftPadBytes(token.Bytes(), 32)...)
+	input = append(input, common.LeftPadBytes(recipient.Bytes(), 32)...)
+	input = append(input, common.LeftPadBytes(amount.Bytes(), 32)...)
+
+	callArgs := map[string]interface{}{
+		"to":    from,
+		"input": hexutil.Bytes(input),
+	}
+	overrides := map[common.Address]map[string]interface{}{
+		from: {"code": hexutil.Bytes(transferProbeCode)},
+	}
+	var result hexutil.Bytes
+	if err := client.Client().CallContext(ctx, &result, "eth_call", callArgs, "latest", overrides); err != nil {
+		return nil, fmt.Errorf("failed to simulate transfer: %v", err)
+	}
+	if len(result) != 32 {
+		return nil, fmt.Errorf("unexpected transfer probe output %x", result)
+	}
+	return new(big.Int).SetBytes(result), nil
+}
@@ -22,16 +22,26 @@ type GasParams struct {
 	MaxPriorityFee *big.Int
 	IsLegacy       bool
 	LegacyGasPrice *big.Int
+	// Tuning is what the fees were derived from; gas limits and bribe tips follow it too.
+	Tuning configs.GasTuning
 }
 
 func getDefaultGasLimits(operation string) uint64 {
 	switch operation {
 	case "approve":
 		return 60000
+	case "permit":
+		return 90000
 	case "swap":
 		return 300000
 	case "addLiquidity":
 		return 400000
+	case "removeLiquidity":
+		return 300000
+	case "mint":
+		return 550000
+	case "bribe":
+		return 80000
 	default:
 		return 200000
 	}
@@ -57,7 +67,15 @@ func WeiToEth(weiStr string) string {
 	return ethFloat.Text('f', 6)
 }
 
-func CalculateDynamicGasParams(ctx context.Context, client *ethclient.Client) (*GasParams, error) {
+func weiStringToGwei(weiStr string) string {
+	wei, ok := new(big.Int).SetString(weiStr, 10)
+	if !ok {
+		return "0"
+	}
+	return WeiToGwei(wei).Text('f', 2)
+}
+
+func CalculateDynamicGasParams(ctx context.Context, client *ethclient.Client, tuning configs.GasTuning) (*GasParams, error) {
 	// Get latest block header
 	header, err := client.HeaderByNumber(ctx, nil)
 	if err != nil {
@@ -79,6 +97,7 @@ func CalculateDynamicGasParams(ctx context.Context, client *ethclient.Client) (*
 		return &GasParams{
 			IsLegacy:       true,
 			LegacyGasPrice: fastGasPrice,
+			Tuning:         tuning,
 		}, nil
 	}
 
@@ -89,16 +108,16 @@ func CalculateDynamicGasParams(ctx context.Context, client *ethclient.Client) (*
 	priorityFee, err := client.SuggestGasTipCap(ctx)
 	if err != nil {
 		// Fallback to minimum priority fee
-		priorityFee = GweiToWei(configs.MIN_PRIORITY_FEE_GWEI)
+		priorityFee = GweiToWei(tuning.MinPriorityFeeGwei)
 	}
 
 	// Apply multiplier for faster inclusion
-	priorityFee = new(big.Int).Mul(priorityFee, big.NewInt(int64(configs.PRIORITY_FEE_MULTIPLIER*100)))
+	priorityFee = new(big.Int).Mul(priorityFee, big.NewInt(int64(tuning.PriorityFeeMultiplier*100)))
 	priorityFee = new(big.Int).Div(priorityFee, big.NewInt(100))
 
 	// Enforce min/max bounds
-	minPriorityFee := GweiToWei(configs.MIN_PRIORITY_FEE_GWEI)
-	maxPriorityFee := GweiToWei(configs.MAX_PRIORITY_FEE_GWEI)
+	minPriorityFee := GweiToWei(tuning.MinPriorityFeeGwei)
+	maxPriorityFee := GweiToWei(tuning.MaxPriorityFeeGwei)
 
 	if priorityFee.Cmp(minPriorityFee) < 0 {
 		priorityFee = minPriorityFee
@@ -108,7 +127,7 @@ func CalculateDynamicGasParams(ctx context.Context, client *ethclient.Client) (*
 	}
 
 	// Calculate maxFeePerGas = (baseFee * multiplier) + priorityFee
-	maxBaseFee := new(big.Float).Mul(new(big.Float).SetInt(baseFee), big.NewFloat(configs.BASE_FEE_MULTIPLIER))
+	maxBaseFee := new(big.Float).Mul(new(big.Float).SetInt(baseFee), big.NewFloat(tuning.BaseFeeMultiplier))
 	maxBaseFeeInt, _ := maxBaseFee.Int(nil)
 	maxFeePerGas := new(big.Int).Add(maxBaseFeeInt, priorityFee)
 
@@ -121,17 +140,18 @@ func CalculateDynamicGasParams(ctx context.Context, client *ethclient.Client) (*
 		MaxFeePerGas:   maxFeePerGas,
 		MaxPriorityFee: priorityFee,
 		IsLegacy:       false,
+		Tuning:         tuning,
 	}, nil
 }
 
-func estimateGasWithRetry(ctx context.Context, client *ethclient.Client, msg ethereum.CallMsg, retries int) (uint64, error) {
+func estimateGasWithRetry(ctx context.Context, client *ethclient.Client, msg ethereum.CallMsg, retries int, bufferPercent uint64) (uint64, error) {
 	var lastErr error
 
 	for i := 0; i < retries; i++ {
 		gasLimit, err := client.EstimateGas(ctx, msg)
 		if err == nil {
 			// Add buffer to prevent out-of-gas errors
-			bufferedGas := gasLimit * (100 + configs.GAS_LIMIT_BUFFER_PERCENT) / 100
+			bufferedGas := gasLimit * (100 + bufferPercent) / 100
 			return bufferedGas, nil
 		}
 
@@ -143,3 +163,21 @@ func estimateGasWithRetry(ctx context.Context, client *ethclient.Client, msg eth
 
 	return 0, fmt.Errorf("gas estimation failed after %d retries: %v", retries, lastErr)
 }
+
+// withBribeTip returns a copy of gasParams with the priority fee lowered to the tuning's
+// BribePriorityFeeGwei, for bundles that pay the builder through a coinbase transfer instead.
+func withBribeTip(gasParams *GasParams) *GasParams {
+	if gasParams.IsLegacy {
+		return gasParams
+	}
+
+	bribeTip := GweiToWei(gasParams.Tuning.BribePriorityFeeGwei)
+	if bribeTip.Cmp(gasParams.MaxPriorityFee) >= 0 {
+		return gasParams
+	}
+
+	lowered := *gasParams
+	lowered.MaxFeePerGas = new(big.Int).Sub(gasParams.MaxFeePerGas, new(big.Int).Sub(gasParams.MaxPriorityFee, bribeTip))
+	lowered.MaxPriorityFee = bribeTip
+	return &lowered
+}
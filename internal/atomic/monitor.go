@@ -0,0 +1,191 @@
+package atomic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+)
+
+// TxStatus is the on-chain outcome of one bundle transaction.
+type TxStatus int
+
+const (
+	TxPending TxStatus = iota
+	TxIncluded
+	TxReverted
+	// TxNonceConsumed means another transaction of the account was mined with the same nonce.
+	TxNonceConsumed
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case TxIncluded:
+		return "included"
+	case TxReverted:
+		return "reverted"
+	case TxNonceConsumed:
+		return "nonce consumed by other"
+	default:
+		return "pending"
+	}
+}
+
+// TxInclusion is the status of one bundle transaction. Block and GasUsed are set once it is mined.
+type TxInclusion struct {
+	Hash    common.Hash
+	Nonce   uint64
+	Status  TxStatus
+	Block   uint64
+	GasUsed uint64
+}
+
+// InclusionResult reports every bundle transaction after the target blocks FirstBlock to
+// LastBlock have been watched.
+type InclusionResult struct {
+	Txs        []TxInclusion
+	FirstBlock uint64
+	LastBlock  uint64
+	TimedOut   bool
+}
+
+// Err returns an *InclusionError unless every transaction was included, the legs at the
+// revertible indexes being allowed to revert.
+func (r *InclusionResult) Err(revertible []int) error {
+	allowed := make(map[int]bool)
+	for _, i := range revertible {
+		allowed[i] = true
+	}
+	for i, tx := range r.Txs {
+		if tx.Status == TxIncluded || (tx.Status == TxReverted && allowed[i]) {
+			continue
+		}
+		return &InclusionError{Result: r}
+	}
+	return nil
+}
+
+// InclusionError is returned when a bundle did not land in full within its target blocks.
+type InclusionError struct {
+	Result *InclusionResult
+}
+
+func (e *InclusionError) Error() string {
+	statuses := make([]string, len(e.Result.Txs))
+	for i, tx := range e.Result.Txs {
+		statuses[i] = fmt.Sprintf("tx %d %s", i+1, tx.Status)
+	}
+	reason := fmt.Sprintf("blocks %d-%d passed", e.Result.FirstBlock, e.Result.LastBlock)
+	if e.Result.TimedOut {
+		reason = "timed out"
+	}
+	return fmt.Sprintf("bundle not fully included (%s): %s", reason, strings.Join(statuses, ", "))
+}
+
+// final reports whether the status can no longer change.
+func (t *TxInclusion) final() bool {
+	return t.Status != TxPending
+}
+
+// monitorBundleInclusion follows new heads until every transaction of the bundle is final, the
+// head passes lastBlock or timeout expires, and reports each transaction's status. Failed
+// lookups leave a transaction pending; a bundle that did not land is reported through the result.
+func monitorBundleInclusion(ctx context.Context, fb *flashbot.Client, lease *NonceLease, txs []*types.Transaction, firstBlock, lastBlock uint64, bundleHashes map[uint64]string, timeout time.Duration) (*InclusionResult, error) {
+	client := fb.Eth()
+	log.Printf("⏳ Monitoring bundle inclusion in blocks %d-%d (timeout: %v)...", firstBlock, lastBlock, timeout)
+	defer reportBundleStats(ctx, fb, bundleHashes)
+
+	startTime := time.Now()
+	heads, stop := fb.WatchNewHeads(ctx, time.Second)
+	defer stop()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	result := &InclusionResult{Txs: make([]TxInclusion, len(txs)), FirstBlock: firstBlock, LastBlock: lastBlock}
+	for i, tx := range txs {
+		result.Txs[i] = TxInclusion{Hash: tx.Hash(), Nonce: tx.Nonce()}
+	}
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %v", err)
+	}
+	for {
+		pending := 0
+		for i := range result.Txs {
+			status := &result.Txs[i]
+			if status.final() {
+				continue
+			}
+			if err := checkInclusion(ctx, lease, txs[i], status); err != nil {
+				log.Printf("⚠️  Failed to check transaction %d: %v", i+1, err)
+			}
+			if !status.final() {
+				pending++
+				continue
+			}
+			switch status.Status {
+			case TxIncluded:
+				log.Printf("✅ Transaction %d included in block %d (gas used: %d)", i+1, status.Block, status.GasUsed)
+			case TxReverted:
+				log.Printf("❌ Transaction %d reverted in block %d (gas used: %d)", i+1, status.Block, status.GasUsed)
+			case TxNonceConsumed:
+				log.Printf("⚠️  Transaction %d will never land: nonce %d was consumed by a competing transaction", i+1, status.Nonce)
+			}
+		}
+
+		if pending == 0 {
+			log.Printf("🎉 All transactions final! Total time: %v", time.Since(startTime).Truncate(time.Millisecond))
+			return result, nil
+		}
+		if header.Number.Uint64() > lastBlock {
+			log.Printf("⌛ Block %d is past the target window with %d/%d transaction(s) pending", header.Number.Uint64(), pending, len(txs))
+			return result, nil
+		}
+		log.Printf("⏱️  Block %d: %d/%d transaction(s) pending, elapsed %v", header.Number.Uint64(), pending, len(txs), time.Since(startTime).Truncate(time.Second))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			result.TimedOut = true
+			return result, nil
+		case header = <-heads:
+		}
+	}
+}
+
+// checkInclusion updates status from the receipt of tx, or from the account nonce when tx has
+// no receipt yet.
+func checkInclusion(ctx context.Context, lease *NonceLease, tx *types.Transaction, status *TxInclusion) error {
+	receipt, err := lease.client.TransactionReceipt(ctx, tx.Hash())
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return fmt.Errorf("failed to get receipt of %s: %v", tx.Hash().Hex(), err)
+	}
+	if err == nil {
+		status.Block = receipt.BlockNumber.Uint64()
+		status.GasUsed = receipt.GasUsed
+		status.Status = TxIncluded
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			status.Status = TxReverted
+		}
+		return nil
+	}
+
+	consumed, err := lease.ConsumedByOther(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if consumed {
+		status.Status = TxNonceConsumed
+	}
+	return nil
+}
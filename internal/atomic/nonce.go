@@ -0,0 +1,151 @@
+package atomic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gofrs/flock"
+)
+
+// NonceManager hands out the nonces of bundle legs. Operations on the same account are
+// serialised, and each one starts from the account's mined nonce so that transactions stuck in
+// the public mempool are replaced by the bundle instead of blocking it. Besides the in-process
+// lock, an account is locked through a file in lockDir, so two runs of the bot sharing lockDir
+// never sign the same nonces; runs on different machines or lock directories are not covered.
+type NonceManager struct {
+	client  *ethclient.Client
+	lockDir string
+
+	mu    sync.Mutex
+	locks map[common.Address]chan struct{}
+}
+
+// NewNonceManager keeps its per-account lock files in lockDir, see configs.Config.NonceLockDir.
+func NewNonceManager(client *ethclient.Client, lockDir string) *NonceManager {
+	return &NonceManager{client: client, lockDir: lockDir, locks: make(map[common.Address]chan struct{})}
+}
+
+// NonceLease is the nonce range of one operation. The account stays locked until Release.
+type NonceLease struct {
+	Account common.Address
+	// Base is the nonce of the first leg; leg i uses Base+i.
+	Base uint64
+	// Pending is the number of the account's transactions waiting in the mempool at Base and above.
+	Pending uint64
+
+	client *ethclient.Client
+	unlock func()
+}
+
+func (m *NonceManager) lock(account common.Address) chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.locks[account]
+	if !ok {
+		l = make(chan struct{}, 1)
+		m.locks[account] = l
+	}
+	return l
+}
+
+// Acquire waits until no other operation holds account and reconciles its latest and pending
+// nonces. A pending nonce above the latest one means transactions sit in the mempool between
+// them; the lease starts at the latest nonce so the bundle replaces them.
+func (m *NonceManager) Acquire(ctx context.Context, account common.Address) (*NonceLease, error) {
+	l := m.lock(account)
+	select {
+	case l <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	fileLock, err := m.lockFile(ctx, account)
+	if err != nil {
+		<-l
+		return nil, err
+	}
+	unlock := func() {
+		fileLock.Unlock()
+		<-l
+	}
+
+	latest, err := m.client.NonceAt(ctx, account, nil)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to get latest nonce: %v", err)
+	}
+	pending, err := m.client.PendingNonceAt(ctx, account)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to get pending nonce: %v", err)
+	}
+
+	lease := &NonceLease{Account: account, Base: latest, client: m.client, unlock: unlock}
+	switch {
+	case pending > latest:
+		lease.Pending = pending - latest
+		log.Printf("⚠️  %d transaction(s) of %s pending in the mempool (nonces %d-%d), the bundle replaces them from nonce %d",
+			lease.Pending, account.Hex(), latest, pending-1, latest)
+	case pending < latest:
+		log.Printf("⚠️  Pending nonce %d of %s is behind the latest nonce %d, using %d", pending, account.Hex(), latest, latest)
+	}
+	log.Printf("🔢 Nonce lease for %s starts at %d", account.Hex(), lease.Base)
+	return lease, nil
+}
+
+// lockFile takes the account's lock file, waiting while another process holds it.
+func (m *NonceManager) lockFile(ctx context.Context, account common.Address) (*flock.Flock, error) {
+	if err := os.MkdirAll(m.lockDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create nonce lock directory: %v", err)
+	}
+	fileLock := flock.New(filepath.Join(m.lockDir, fmt.Sprintf(".nonce-%s.lock", account.Hex())))
+	locked, err := fileLock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %v", fileLock.Path(), err)
+	}
+	if !locked {
+		log.Printf("⏳ Another run holds the nonces of %s (%s), waiting for it", account.Hex(), fileLock.Path())
+		if _, err := fileLock.TryLockContext(ctx, 500*time.Millisecond); err != nil {
+			return nil, fmt.Errorf("failed to lock %s: %v", fileLock.Path(), err)
+		}
+	}
+	return fileLock, nil
+}
+
+// Release lets the next operation on the account acquire it.
+func (l *NonceLease) Release() {
+	if l.unlock != nil {
+		l.unlock()
+		l.unlock = nil
+	}
+}
+
+// ConsumedByOther reports whether the nonce of tx was mined in a different transaction, which
+// means tx can never be included.
+func (l *NonceLease) ConsumedByOther(ctx context.Context, tx *types.Transaction) (bool, error) {
+	latest, err := l.client.NonceAt(ctx, l.Account, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get latest nonce: %v", err)
+	}
+	if latest <= tx.Nonce() {
+		return false, nil
+	}
+
+	_, err = l.client.TransactionReceipt(ctx, tx.Hash())
+	if err == nil {
+		return false, nil
+	}
+	if errors.Is(err, ethereum.NotFound) {
+		return true, nil
+	}
+	return false, fmt.Errorf("failed to get receipt of %s: %v", tx.Hash().Hex(), err)
+}
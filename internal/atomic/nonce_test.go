@@ -0,0 +1,36 @@
+package atomic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/atomic"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/testchain"
+)
+
+// Two managers sharing a lock directory stand for two runs of the bot on the same account.
+func TestNonceLeaseExcludesOtherRuns(t *testing.T) {
+	chain := testchain.New(t)
+	lockDir := t.TempDir()
+	first := atomic.NewNonceManager(chain.Client, lockDir)
+	second := atomic.NewNonceManager(chain.Client, lockDir)
+
+	lease, err := first.Acquire(context.Background(), chain.EOA())
+	if err != nil {
+		t.Fatalf("first run failed to acquire the account: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := second.Acquire(ctx, chain.EOA()); err == nil {
+		t.Fatal("second run acquired an account the first run still holds")
+	}
+
+	lease.Release()
+	again, err := second.Acquire(context.Background(), chain.EOA())
+	if err != nil {
+		t.Fatalf("second run failed to acquire the released account: %v", err)
+	}
+	again.Release()
+}
@@ -0,0 +1,105 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// candidatePaths returns the direct path and every path through one or two of baseTokens,
+// skipping hops that revisit a token or leave through excluded.
+func candidatePaths(tokenIn, tokenOut common.Address, baseTokens []common.Address, excluded ...common.Address) [][]common.Address {
+	skip := map[common.Address]bool{tokenIn: true, tokenOut: true}
+	for _, token := range excluded {
+		skip[token] = true
+	}
+
+	var bases []common.Address
+	for _, base := range baseTokens {
+		if !skip[base] {
+			bases = append(bases, base)
+		}
+	}
+
+	paths := [][]common.Address{{tokenIn, tokenOut}}
+	for _, base := range bases {
+		paths = append(paths, []common.Address{tokenIn, base, tokenOut})
+	}
+	for _, first := range bases {
+		for _, second := range bases {
+			if first != second {
+				paths = append(paths, []common.Address{tokenIn, first, second, tokenOut})
+			}
+		}
+	}
+	return paths
+}
+
+// findBestPath quotes amountIn along every candidate path through baseTokens and returns the one
+// with the largest output on dex. Paths without a pool for every hop fail to quote and are skipped.
+func findBestPath(ctx context.Context, dex DEX, tokens *TokenRegistry, baseTokens []common.Address, amountIn *big.Int, tokenIn, tokenOut common.Address, excluded ...common.Address) ([]common.Address, *big.Int, error) {
+	var bestPath []common.Address
+	var bestOut *big.Int
+	for _, path := range candidatePaths(tokenIn, tokenOut, baseTokens, excluded...) {
+		amountOut, err := dex.Quote(ctx, amountIn, path)
+		if err != nil {
+			continue
+		}
+		if bestOut == nil || amountOut.Cmp(bestOut) > 0 {
+			bestPath, bestOut = path, amountOut
+		}
+	}
+	if bestPath == nil {
+		return nil, nil, fmt.Errorf("no swap path from %s to %s", tokenIn.Hex(), tokenOut.Hex())
+	}
+
+	inInfo, err := tokens.Info(ctx, tokenIn)
+	if err != nil {
+		return nil, nil, err
+	}
+	outInfo, err := tokens.Info(ctx, tokenOut)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Best path %s: %s → %s", formatPath(bestPath), inInfo.Format(amountIn), outInfo.Format(bestOut))
+	return bestPath, bestOut, nil
+}
+
+func formatPath(path []common.Address) string {
+	hops := make([]string, len(path))
+	for i, token := range path {
+		hops[i] = token.Hex()
+	}
+	return strings.Join(hops, " → ")
+}
+
+// swapMethod picks the router function for an exact-input swap along path. ethIn and ethOut
+// select the native ETH variants, which require path to start or end with weth.
+func swapMethod(path []common.Address, weth common.Address, ethIn, ethOut, feeOnTransfer bool) (string, error) {
+	if ethIn && path[0] != weth {
+		return "", fmt.Errorf("ETH input path must start with WETH, got %s", formatPath(path))
+	}
+	if ethOut && path[len(path)-1] != weth {
+		return "", fmt.Errorf("ETH output path must end with WETH, got %s", formatPath(path))
+	}
+
+	var method string
+	switch {
+	case ethIn && ethOut:
+		return "", fmt.Errorf("cannot swap ETH for ETH")
+	case ethIn:
+		method = "swapExactETHForTokens"
+	case ethOut:
+		method = "swapExactTokensForETH"
+	default:
+		method = "swapExactTokensForTokens"
+	}
+	if feeOnTransfer {
+		method += "SupportingFeeOnTransferTokens"
+	}
+	return method, nil
+}
@@ -0,0 +1,106 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// PairReserves holds the reserves of a Uniswap V2 pair ordered by the caller's view of the pair.
+type PairReserves struct {
+	Pair       common.Address
+	ReserveIn  *big.Int
+	ReserveOut *big.Int
+}
+
+func callView(ctx context.Context, client *ethclient.Client, contractABI *abi.ABI, to common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s: %v", method, err)
+	}
+
+	result, err := client.CallContract(ctx, ethereum.CallMsg{
+		To:   &to,
+		Data: data,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %v", method, err)
+	}
+
+	values, err := contractABI.Unpack(method, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %v", method, err)
+	}
+	return values, nil
+}
+
+// getPairReserves resolves the pair for tokenIn/tokenOut on factoryAddr and returns its reserves
+// with ReserveIn belonging to tokenIn.
+func getPairReserves(ctx context.Context, client *ethclient.Client, factoryAddr, tokenIn, tokenOut common.Address) (*PairReserves, error) {
+	factoryABI, err := abi.JSON(strings.NewReader(configs.FactoryABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse factory ABI: %v", err)
+	}
+	pairABI, err := abi.JSON(strings.NewReader(configs.PairABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pair ABI: %v", err)
+	}
+
+	values, err := callView(ctx, client, &factoryABI, factoryAddr, "getPair", tokenIn, tokenOut)
+	if err != nil {
+		return nil, err
+	}
+	pairAddr := values[0].(common.Address)
+	if pairAddr == (common.Address{}) {
+		return nil, fmt.Errorf("no pair for %s/%s on factory %s", tokenIn.Hex(), tokenOut.Hex(), factoryAddr.Hex())
+	}
+
+	values, err = callView(ctx, client, &pairABI, pairAddr, "token0")
+	if err != nil {
+		return nil, err
+	}
+	token0 := values[0].(common.Address)
+
+	values, err = callView(ctx, client, &pairABI, pairAddr, "getReserves")
+	if err != nil {
+		return nil, err
+	}
+	reserve0, reserve1 := values[0].(*big.Int), values[1].(*big.Int)
+
+	reserves := &PairReserves{Pair: pairAddr, ReserveIn: reserve0, ReserveOut: reserve1}
+	if token0 != tokenIn {
+		reserves.ReserveIn, reserves.ReserveOut = reserve1, reserve0
+	}
+	return reserves, nil
+}
+
+// calculateZapSwapAmount returns how much of amountIn to swap so that the swap output and the
+// remaining input match the post-swap pool ratio, accounting for the 0.3% fee and price impact:
+//
+//	s = (sqrt(r * (r*3988009 + a*3988000)) - r*1997) / 1994
+func calculateZapSwapAmount(reserveIn, amountIn *big.Int) *big.Int {
+	inner := new(big.Int).Mul(reserveIn, big.NewInt(3988009))
+	inner.Add(inner, new(big.Int).Mul(amountIn, big.NewInt(3988000)))
+	inner.Mul(inner, reserveIn)
+
+	swapAmount := new(big.Int).Sqrt(inner)
+	swapAmount.Sub(swapAmount, new(big.Int).Mul(reserveIn, big.NewInt(1997)))
+	return swapAmount.Div(swapAmount, big.NewInt(1994))
+}
+
+// getAmountOut mirrors UniswapV2Library.getAmountOut, including the 0.3% fee.
+func getAmountOut(amountIn, reserveIn, reserveOut *big.Int) *big.Int {
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(997))
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Mul(reserveIn, big.NewInt(1000))
+	denominator.Add(denominator, amountInWithFee)
+	return numerator.Div(numerator, denominator)
+}
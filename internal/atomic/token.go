@@ -0,0 +1,111 @@
+package atomic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// TokenInfo is the immutable ERC-20 metadata of a token.
+type TokenInfo struct {
+	Address  common.Address
+	Name     string
+	Symbol   string
+	Decimals uint8
+}
+
+// Format renders amount in whole token units followed by the symbol.
+func (t *TokenInfo) Format(amount *big.Int) string {
+	return fmt.Sprintf("%s %s", formatTokenAmount(amount, int(t.Decimals)), t.Symbol)
+}
+
+// TokenRegistry reads ERC-20 metadata once per address and serves balances and allowances.
+type TokenRegistry struct {
+	client   *ethclient.Client
+	erc20ABI abi.ABI
+
+	mu    sync.Mutex
+	cache map[common.Address]*TokenInfo
+}
+
+func NewTokenRegistry(client *ethclient.Client) (*TokenRegistry, error) {
+	erc20ABI, err := abi.JSON(strings.NewReader(configs.Erc20ABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ERC20 ABI: %v", err)
+	}
+	return &TokenRegistry{client: client, erc20ABI: erc20ABI, cache: make(map[common.Address]*TokenInfo)}, nil
+}
+
+// Info returns the metadata of token, fetching it on first use.
+func (r *TokenRegistry) Info(ctx context.Context, token common.Address) (*TokenInfo, error) {
+	r.mu.Lock()
+	info, ok := r.cache[token]
+	r.mu.Unlock()
+	if ok {
+		return info, nil
+	}
+
+	values, err := callView(ctx, r.client, &r.erc20ABI, token, "decimals")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decimals of %s: %v", token.Hex(), err)
+	}
+	info = &TokenInfo{Address: token, Decimals: values[0].(uint8)}
+
+	// Name and symbol are optional in ERC-20 and some early tokens return bytes32
+	if info.Symbol, err = r.readString(ctx, token, "symbol"); err != nil {
+		info.Symbol = token.Hex()[:10]
+	}
+	if info.Name, err = r.readString(ctx, token, "name"); err != nil {
+		info.Name = info.Symbol
+	}
+
+	r.mu.Lock()
+	r.cache[token] = info
+	r.mu.Unlock()
+	return info, nil
+}
+
+// readString calls a string getter, accepting both ABI strings and bytes32 return data.
+func (r *TokenRegistry) readString(ctx context.Context, token common.Address, method string) (string, error) {
+	data, err := r.erc20ABI.Pack(method)
+	if err != nil {
+		return "", err
+	}
+	result, err := r.client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return "", err
+	}
+	if values, err := r.erc20ABI.Unpack(method, result); err == nil {
+		return values[0].(string), nil
+	}
+	if len(result) == 32 {
+		return string(bytes.TrimRight(result, "\x00")), nil
+	}
+	return "", fmt.Errorf("unexpected %s return data %x", method, result)
+}
+
+func (r *TokenRegistry) BalanceOf(ctx context.Context, token, owner common.Address) (*big.Int, error) {
+	values, err := callView(ctx, r.client, &r.erc20ABI, token, "balanceOf", owner)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].(*big.Int), nil
+}
+
+func (r *TokenRegistry) Allowance(ctx context.Context, token, owner, spender common.Address) (*big.Int, error) {
+	values, err := callView(ctx, r.client, &r.erc20ABI, token, "allowance", owner, spender)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].(*big.Int), nil
+}
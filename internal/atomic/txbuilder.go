@@ -2,7 +2,6 @@ package atomic
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"log"
 	"math/big"
@@ -11,12 +10,24 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 
-	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
 )
 
+// TxOpts is the signing context of one bundle leg.
+type TxOpts struct {
+	Signer    signer.Signer
+	ChainID   *big.Int
+	Nonce     uint64
+	GasParams *GasParams
+	Deadline  *big.Int
+}
+
+func (o TxOpts) From() common.Address {
+	return o.Signer.Address()
+}
+
 func applySlippage(amount *big.Int, slippagePercent float64) *big.Int {
 	slippageMultiplier := big.NewFloat(1.0 - slippagePercent)
 	amountFloat := new(big.Float).SetInt(amount)
@@ -25,122 +36,140 @@ func applySlippage(amount *big.Int, slippagePercent float64) *big.Int {
 	return minAmount
 }
 
-func createApproveTransaction(ctx context.Context, client *ethclient.Client, key *ecdsa.PrivateKey, chainID *big.Int, nonce uint64, gasParams *GasParams, tokenAddr common.Address, amount *big.Int, erc20ABI *abi.ABI) (*types.Transaction, error) {
-	data, err := erc20ABI.Pack("approve", common.HexToAddress(configs.UNISWAP_V2_ROUTER_ADDR), amount)
-	if err != nil {
-		return nil, fmt.Errorf("failed to pack approve data: %v", err)
-	}
+// movedBeyond reports whether current differs from quoted by more than bps basis points of
+// quoted.
+func movedBeyond(quoted, current *big.Int, bps uint64) bool {
+	move := new(big.Int).Sub(current, quoted)
+	move.Abs(move).Mul(move, big.NewInt(10000))
+	return move.Cmp(new(big.Int).Mul(quoted, new(big.Int).SetUint64(bps))) > 0
+}
 
+// signCall estimates and signs a call of data to to, falling back to the default gas limit of
+// operation when estimation fails. A nil to signs a contract creation.
+func signCall(ctx context.Context, client *ethclient.Client, opts TxOpts, to *common.Address, value *big.Int, data []byte, operation string) (*types.Transaction, error) {
 	// Estimate gas
 	gasLimit, err := estimateGasWithRetry(ctx, client, ethereum.CallMsg{
-		From: crypto.PubkeyToAddress(key.PublicKey),
-		To:   &tokenAddr,
-		Data: data,
-	}, 3)
+		From:  opts.From(),
+		To:    to,
+		Value: value,
+		Data:  data,
+	}, 3, opts.GasParams.Tuning.GasLimitBufferPercent)
 	if err != nil {
-		log.Printf("⚠️  Using default gas limit for approve: %v", err)
-		gasLimit = getDefaultGasLimits("approve")
-		gasLimit = gasLimit * (100 + configs.GAS_LIMIT_BUFFER_PERCENT) / 100
+		log.Printf("⚠️  Using default gas limit for %s: %v", operation, err)
+		gasLimit = getDefaultGasLimits(operation)
+		gasLimit = gasLimit * (100 + opts.GasParams.Tuning.GasLimitBufferPercent) / 100
 	}
 
 	// Create transaction based on gas type
+	gasParams := opts.GasParams
+	var tx *types.Transaction
 	if gasParams.IsLegacy {
-		tx := types.NewTransaction(nonce, tokenAddr, big.NewInt(0), gasLimit, gasParams.LegacyGasPrice, data)
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+		tx = types.NewTx(&types.LegacyTx{
+			Nonce:    opts.Nonce,
+			GasPrice: gasParams.LegacyGasPrice,
+			Gas:      gasLimit,
+			To:       to,
+			Value:    value,
+			Data:     data,
+		})
 	} else {
-		tx := types.NewTx(&types.DynamicFeeTx{
-			ChainID:   chainID,
-			Nonce:     nonce,
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   opts.ChainID,
+			Nonce:     opts.Nonce,
 			GasTipCap: gasParams.MaxPriorityFee,
 			GasFeeCap: gasParams.MaxFeePerGas,
 			Gas:       gasLimit,
-			To:        &tokenAddr,
-			Value:     big.NewInt(0),
+			To:        to,
+			Value:     value,
 			Data:      data,
 		})
-		return types.SignTx(tx, types.NewLondonSigner(chainID), key)
 	}
+	return opts.Signer.SignTx(ctx, tx, opts.ChainID)
 }
 
-func createSwapTransaction(ctx context.Context, client *ethclient.Client, key *ecdsa.PrivateKey, chainID *big.Int, to common.Address, nonce uint64, gasParams *GasParams, deadline, value, amountOutMin *big.Int, path []common.Address, routerABI *abi.ABI) (*types.Transaction, error) {
-	data, err := routerABI.Pack("swapExactETHForTokens", amountOutMin, path, to, deadline)
+func createApproveTransaction(ctx context.Context, client *ethclient.Client, opts TxOpts, tokenAddr, spender common.Address, amount *big.Int, erc20ABI *abi.ABI) (*types.Transaction, error) {
+	data, err := erc20ABI.Pack("approve", spender, amount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to pack swap data: %v", err)
+		return nil, fmt.Errorf("failed to pack approve data: %v", err)
 	}
+	return signCall(ctx, client, opts, &tokenAddr, big.NewInt(0), data, "approve")
+}
 
-	routerAddr := common.HexToAddress(configs.UNISWAP_V2_ROUTER_ADDR)
-
-	// Estimate gas
-	gasLimit, err := estimateGasWithRetry(ctx, client, ethereum.CallMsg{
-		From:  to,
-		To:    &routerAddr,
-		Value: value,
-		Data:  data,
-	}, 3)
+// createSwapTransaction swaps value ETH along path. Fee-on-transfer tokens use the router variant
+// that checks amountOutMin against the balance actually received.
+func createSwapTransaction(ctx context.Context, client *ethclient.Client, opts TxOpts, value, amountOutMin *big.Int, path []common.Address, feeOnTransfer bool, routerAddr, weth common.Address, routerABI *abi.ABI) (*types.Transaction, error) {
+	method, err := swapMethod(path, weth, true, false, feeOnTransfer)
 	if err != nil {
-		log.Printf("⚠️  Using default gas limit for swap: %v", err)
-		gasLimit = getDefaultGasLimits("swap")
-		gasLimit = gasLimit * (100 + configs.GAS_LIMIT_BUFFER_PERCENT) / 100
+		return nil, err
 	}
+	data, err := routerABI.Pack(method, amountOutMin, path, opts.From(), opts.Deadline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack swap data: %v", err)
+	}
+	return signCall(ctx, client, opts, &routerAddr, value, data, "swap")
+}
 
-	// Create transaction based on gas type
-	if gasParams.IsLegacy {
-		tx := types.NewTransaction(nonce, routerAddr, value, gasLimit, gasParams.LegacyGasPrice, data)
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
-	} else {
-		tx := types.NewTx(&types.DynamicFeeTx{
-			ChainID:   chainID,
-			Nonce:     nonce,
-			GasTipCap: gasParams.MaxPriorityFee,
-			GasFeeCap: gasParams.MaxFeePerGas,
-			Gas:       gasLimit,
-			To:        &routerAddr,
-			Value:     value,
-			Data:      data,
-		})
-		return types.SignTx(tx, types.NewLondonSigner(chainID), key)
+// createTokenSwapTransaction swaps amountIn of path[0] along path, paying out ETH when ethOut is
+// set and path[len(path)-1] otherwise. The router method follows from the path, see swapMethod.
+func createTokenSwapTransaction(ctx context.Context, client *ethclient.Client, opts TxOpts, amountIn, amountOutMin *big.Int, path []common.Address, ethOut, feeOnTransfer bool, routerAddr, weth common.Address, routerABI *abi.ABI) (*types.Transaction, error) {
+	method, err := swapMethod(path, weth, false, ethOut, feeOnTransfer)
+	if err != nil {
+		return nil, err
 	}
+	data, err := routerABI.Pack(method, amountIn, amountOutMin, path, opts.From(), opts.Deadline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack swap data: %v", err)
+	}
+	return signCall(ctx, client, opts, &routerAddr, big.NewInt(0), data, "swap")
 }
 
-func createAddLiquidityTransaction(ctx context.Context, client *ethclient.Client, key *ecdsa.PrivateKey, chainID *big.Int, to common.Address, nonce uint64, gasParams *GasParams, deadline *big.Int, tokenAddr common.Address, tokenAmount, ethAmount *big.Int, slippage float64, routerABI *abi.ABI) (*types.Transaction, error) {
-	amountTokenMin := applySlippage(tokenAmount, slippage)
-	amountETHMin := applySlippage(ethAmount, slippage)
+// conservativeLiquidityAmounts sizes the liquidity leg from the swap's guaranteed minimum output
+// rather than the quote, so the leg never pulls more tokens than the swap delivered. The ETH
+// minimum is scaled down by the same ratio, since the router only pairs ETH for the tokens supplied.
+func conservativeLiquidityAmounts(expectedTokenAmount, amountOutMin, ethAmount *big.Int, slippage float64) (tokenAmount, amountETHMin *big.Int) {
+	ethForTokens := new(big.Int).Mul(ethAmount, amountOutMin)
+	ethForTokens.Div(ethForTokens, expectedTokenAmount)
+	return amountOutMin, applySlippage(ethForTokens, slippage)
+}
 
-	data, err := routerABI.Pack("addLiquidityETH", tokenAddr, tokenAmount, amountTokenMin, amountETHMin, to, deadline)
+func createAddLiquidityTransaction(ctx context.Context, client *ethclient.Client, opts TxOpts, tokenAddr common.Address, tokenAmount, amountTokenMin, ethAmount, amountETHMin *big.Int, routerAddr common.Address, routerABI *abi.ABI) (*types.Transaction, error) {
+	data, err := routerABI.Pack("addLiquidityETH", tokenAddr, tokenAmount, amountTokenMin, amountETHMin, opts.From(), opts.Deadline)
 	if err != nil {
 		return nil, fmt.Errorf("failed to pack add liquidity data: %v", err)
 	}
+	return signCall(ctx, client, opts, &routerAddr, ethAmount, data, "addLiquidity")
+}
 
-	routerAddr := common.HexToAddress(configs.UNISWAP_V2_ROUTER_ADDR)
-
-	// Estimate gas
-	gasLimit, err := estimateGasWithRetry(ctx, client, ethereum.CallMsg{
-		From:  to,
-		To:    &routerAddr,
-		Value: ethAmount,
-		Data:  data,
-	}, 3)
+func createRemoveLiquidityTransaction(ctx context.Context, client *ethclient.Client, opts TxOpts, tokenAddr common.Address, liquidity, amountTokenMin, amountETHMin *big.Int, feeOnTransfer bool, routerAddr common.Address, routerABI *abi.ABI) (*types.Transaction, error) {
+	data, err := routerABI.Pack(removeLiquidityMethod(feeOnTransfer), tokenAddr, liquidity, amountTokenMin, amountETHMin, opts.From(), opts.Deadline)
 	if err != nil {
-		log.Printf("⚠️  Using default gas limit for addLiquidity: %v", err)
-		gasLimit = getDefaultGasLimits("addLiquidity")
-		gasLimit = gasLimit * (100 + configs.GAS_LIMIT_BUFFER_PERCENT) / 100
+		return nil, fmt.Errorf("failed to pack remove liquidity data: %v", err)
 	}
+	return signCall(ctx, client, opts, &routerAddr, big.NewInt(0), data, "removeLiquidity")
+}
 
-	// Create transaction based on gas type
-	if gasParams.IsLegacy {
-		tx := types.NewTransaction(nonce, routerAddr, ethAmount, gasLimit, gasParams.LegacyGasPrice, data)
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
-	} else {
-		tx := types.NewTx(&types.DynamicFeeTx{
-			ChainID:   chainID,
-			Nonce:     nonce,
-			GasTipCap: gasParams.MaxPriorityFee,
-			GasFeeCap: gasParams.MaxFeePerGas,
-			Gas:       gasLimit,
-			To:        &routerAddr,
-			Value:     ethAmount,
-			Data:      data,
-		})
-		return types.SignTx(tx, types.NewLondonSigner(chainID), key)
+// removeLiquidityMethod is the router function that burns Token/WETH liquidity. The
+// fee-on-transfer variant forwards the tokens that reached the router instead of the amount
+// burned, which a transfer fee leaves it short of.
+func removeLiquidityMethod(feeOnTransfer bool) string {
+	if feeOnTransfer {
+		return "removeLiquidityETHSupportingFeeOnTransferTokens"
 	}
+	return "removeLiquidityETH"
+}
+
+// coinbasePaymentInitCode forwards msg.value to block.coinbase from a contract-creation
+// transaction, so the bribe reaches whichever builder includes the bundle:
+// PUSH0 PUSH0 PUSH0 PUSH0 CALLVALUE COINBASE GAS CALL STOP
+//
+// The coinbase is unknown when the bundle is signed and the bundle goes to several builders, so
+// a plain transfer cannot be addressed. A payment helper contract would have to be deployed and
+// trusted on every chain, and a priority fee is paid per unit of gas rather than as the direct
+// transfer builders score bundles by. The cost is roughly 32k gas of contract creation, which
+// leaves an account without code behind. The payment itself cannot fail; the revert guard is the
+// swap minimum raised by the bribe, which fails the bundle before this leg runs.
+var coinbasePaymentInitCode = common.FromHex("0x5f5f5f5f34415af100")
+
+func createBribeTransaction(ctx context.Context, client *ethclient.Client, opts TxOpts, amount *big.Int) (*types.Transaction, error) {
+	return signCall(ctx, client, opts, nil, amount, coinbasePaymentInitCode, "bribe")
 }
@@ -0,0 +1,241 @@
+package atomic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// zapQuote holds the amounts of a single-sided zap derived from one snapshot of the pool.
+type zapQuote struct {
+	Token                *TokenInfo
+	Pool                 common.Address
+	Path                 []common.Address
+	EthForSwap           *big.Int
+	EthForLP             *big.Int
+	ExpectedTokenAmount  *big.Int
+	NetTokenAmount       *big.Int
+	FeeOnTransfer        bool
+	AmountOutMin         *big.Int
+	LiquidityTokenAmount *big.Int
+	AmountETHMin         *big.Int
+	// BribeTokens is the coinbase bribe in tokens at the quoted rate, added to the swap minimum.
+	BribeTokens *big.Int
+}
+
+// quoteZap lets the DEX size the swap so the deposit matches the pool, then derives the swap
+// minimum and the conservative liquidity amounts from it.
+// The swap itself takes whichever WETH → token path returns the most for that amount; a
+// multi-hop path is then split again for the liquidity pool's unchanged price.
+// The swap output is also pushed through a simulated transfer from the pool to recipient; if
+// less arrives, the token charges a transfer fee and every downstream amount uses the net.
+func quoteZap(ctx context.Context, client *ethclient.Client, dex DEX, tokens *TokenRegistry, baseTokens []common.Address, tokenAddr, recipient common.Address, ethAmount *big.Int, slippage float64) (*zapQuote, error) {
+	token, err := tokens.Info(ctx, tokenAddr)
+	if err != nil {
+		return nil, err
+	}
+	weth := dex.WETH()
+	pool, err := dex.Pool(ctx, weth, tokenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s pool: %v", dex.Name(), err)
+	}
+
+	// The direct swap's split is the amount the candidate paths are compared at
+	ethForSwap, err := dex.ZapSwapAmount(ctx, tokenAddr, ethAmount)
+	if err != nil {
+		return nil, err
+	}
+	path, expectedTokenAmount, err := findBestPath(ctx, dex, tokens, baseTokens, ethForSwap, weth, tokenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expected token amount: %v", err)
+	}
+
+	// Tokens leave the last hop's pool, which is only the liquidity pool on the direct path
+	lastPool := pool
+	if len(path) > 2 {
+		// A multi-hop swap leaves the liquidity pool's price as it is, so split for that price
+		ethForSwap, err = balancedSwapAmount(ctx, dex, path, tokenAddr, ethAmount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to size the multi-hop swap: %v", err)
+		}
+		expectedTokenAmount, err = dex.Quote(ctx, ethForSwap, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get expected token amount: %v", err)
+		}
+		lastPool, err = dex.Pool(ctx, path[len(path)-2], tokenAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get last hop pool: %v", err)
+		}
+	}
+	if ethForSwap.Sign() <= 0 || ethForSwap.Cmp(ethAmount) >= 0 {
+		return nil, fmt.Errorf("invalid zap swap amount %s for %s wei input", ethForSwap, ethAmount)
+	}
+	// The rest of the ETH is paired with the swapped tokens
+	ethForLP := new(big.Int).Sub(ethAmount, ethForSwap)
+	log.Printf("Pool %s on %s: swapping %s ETH, keeping %s ETH for liquidity", pool.Hex(), dex.Name(), WeiToEth(ethForSwap.String()), WeiToEth(ethForLP.String()))
+	log.Printf("Expected token output: %s", token.Format(expectedTokenAmount))
+
+	netTokenAmount := expectedTokenAmount
+	feeOnTransfer := false
+	received, err := simulateTransfer(ctx, client, tokenAddr, lastPool, recipient, expectedTokenAmount)
+	if err != nil {
+		log.Printf("⚠️  Could not check for transfer fees, assuming a standard token: %v", err)
+	} else if received.Cmp(expectedTokenAmount) < 0 {
+		feeOnTransfer = true
+		netTokenAmount = received
+		feeBps := new(big.Int).Sub(expectedTokenAmount, received)
+		feeBps.Mul(feeBps, big.NewInt(10000)).Div(feeBps, expectedTokenAmount)
+		log.Printf("🧾 Fee-on-transfer token detected: %.2f%% fee, net output %s", float64(feeBps.Int64())/100, token.Format(netTokenAmount))
+	}
+
+	amountOutMin := applySlippage(netTokenAmount, slippage)
+	liquidityTokenAmount, amountETHMin := conservativeLiquidityAmounts(netTokenAmount, amountOutMin, ethForLP, slippage)
+	if len(path) > 2 {
+		// The pool's price is unchanged by the swap, so the ETH minimum is what that price
+		// pairs with the token minimum
+		var ethDeposit *big.Int
+		liquidityTokenAmount, ethDeposit, err = dex.DepositAmounts(ctx, tokenAddr, amountOutMin, ethForLP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to size the deposit: %v", err)
+		}
+		amountETHMin = applySlippage(ethDeposit, slippage)
+	}
+	log.Printf("Liquidity leg sized from swap minimum: %s", token.Format(liquidityTokenAmount))
+
+	return &zapQuote{
+		Token:                token,
+		Pool:                 pool,
+		Path:                 path,
+		EthForSwap:           ethForSwap,
+		EthForLP:             ethForLP,
+		ExpectedTokenAmount:  expectedTokenAmount,
+		NetTokenAmount:       netTokenAmount,
+		FeeOnTransfer:        feeOnTransfer,
+		AmountOutMin:         amountOutMin,
+		LiquidityTokenAmount: liquidityTokenAmount,
+		AmountETHMin:         amountETHMin,
+	}, nil
+}
+
+// balancedSwapAmount splits ethAmount for a multi-hop path, which does not move the liquidity
+// pool: it bisects, to within a basis point of ethAmount, for the largest swap whose tokens
+// the pool takes in full against the rest of the ETH.
+func balancedSwapAmount(ctx context.Context, dex DEX, path []common.Address, token common.Address, ethAmount *big.Int) (*big.Int, error) {
+	tolerance := new(big.Int).Div(ethAmount, big.NewInt(10000))
+	if tolerance.Sign() == 0 {
+		tolerance.SetInt64(1)
+	}
+	low, high := new(big.Int), new(big.Int).Set(ethAmount)
+	for new(big.Int).Sub(high, low).Cmp(tolerance) > 0 {
+		mid := new(big.Int).Add(low, high)
+		mid.Rsh(mid, 1)
+		tokenAmount, err := dex.Quote(ctx, mid, path)
+		if err != nil {
+			return nil, err
+		}
+		tokenDeposit, _, err := dex.DepositAmounts(ctx, token, tokenAmount, new(big.Int).Sub(ethAmount, mid))
+		if err != nil {
+			return nil, err
+		}
+		if tokenDeposit.Cmp(tokenAmount) < 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return low, nil
+}
+
+// stale reports whether the submitted bundle no longer holds at the pools' current prices:
+// the quoted swap would now return less than its minimum, or a pool on its path moved by more
+// than requoteBps basis points.
+func (q *zapQuote) stale(ctx context.Context, dex DEX, requoteBps uint64) (bool, error) {
+	amountOut, err := dex.Quote(ctx, q.EthForSwap, q.Path)
+	if err != nil {
+		return false, err
+	}
+	// The minimums are on the tokens that arrive, net of any transfer fee
+	net := new(big.Int).Mul(amountOut, q.NetTokenAmount)
+	net.Div(net, q.ExpectedTokenAmount)
+	if net.Cmp(q.swapMin()) < 0 || net.Cmp(q.LiquidityTokenAmount) < 0 {
+		return true, nil
+	}
+	return movedBeyond(q.ExpectedTokenAmount, amountOut, requoteBps), nil
+}
+
+// swapMin is the swap leg's minimum output: the slippage floor plus any bribe, so a swap that
+// cannot pay the builder out of its surplus reverts.
+func (q *zapQuote) swapMin() *big.Int {
+	if q.BribeTokens == nil {
+		return q.AmountOutMin
+	}
+	return new(big.Int).Add(q.AmountOutMin, q.BribeTokens)
+}
+
+// surplus is the ETH value, at the quoted rate, of the received tokens above the slippage
+// floor, i.e. what a private submission protects from sandwiching.
+func (q *zapQuote) surplus(received *big.Int) *big.Int {
+	surplus := new(big.Int).Sub(received, q.AmountOutMin)
+	if surplus.Sign() <= 0 {
+		return new(big.Int)
+	}
+	surplus.Mul(surplus, q.EthForSwap)
+	return surplus.Div(surplus, q.NetTokenAmount)
+}
+
+// guard converts bribe to tokens at the rate surplus values them at, or clears it for nil.
+func (q *zapQuote) guard(bribe *big.Int) {
+	if bribe == nil {
+		q.BribeTokens = nil
+		return
+	}
+	q.BribeTokens = new(big.Int).Mul(bribe, q.NetTokenAmount)
+	q.BribeTokens.Div(q.BribeTokens, q.EthForSwap)
+}
+
+// bribeAmount returns the wei paid to block.coinbase for a simulated surplus, or nil when
+// bribing is off. A fixed CoinbaseBribe takes precedence over BribePercent of the surplus.
+func bribeAmount(config *configs.Config, surplus *big.Int) *big.Int {
+	if config.CoinbaseBribe != nil && config.CoinbaseBribe.Sign() > 0 {
+		return config.CoinbaseBribe
+	}
+	if config.BribePercent > 0 {
+		amount, _ := new(big.Float).Mul(new(big.Float).SetInt(surplus), big.NewFloat(config.BribePercent/100)).Int(nil)
+		if amount.Sign() > 0 {
+			return amount
+		}
+	}
+	return nil
+}
+
+// inputSwapQuote converts an ERC-20 input into the ETH the zap starts from.
+type inputSwapQuote struct {
+	Path        []common.Address
+	AmountIn    *big.Int
+	ExpectedETH *big.Int
+	ETHMin      *big.Int
+}
+
+// quoteInputSwap routes config.InputAmount of config.InputToken to WETH along the best path that
+// avoids the zap token, so the conversion leaves the liquidity pair untouched.
+func quoteInputSwap(ctx context.Context, dex DEX, tokens *TokenRegistry, config *configs.Config) (*inputSwapQuote, error) {
+	path, expectedETH, err := findBestPath(ctx, dex, tokens, config.PathBaseTokens, config.InputAmount, config.InputToken, dex.WETH(), config.TokenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to route input token: %v", err)
+	}
+	ethMin := applySlippage(expectedETH, config.SlippageTolerance)
+	log.Printf("Input %s → ~%s ETH (zap uses the %s ETH minimum)", formatPath(path), WeiToEth(expectedETH.String()), WeiToEth(ethMin.String()))
+
+	return &inputSwapQuote{
+		Path:        path,
+		AmountIn:    config.InputAmount,
+		ExpectedETH: expectedETH,
+		ETHMin:      ethMin,
+	}, nil
+}
@@ -0,0 +1,190 @@
+package atomic_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/atomic"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/testchain"
+)
+
+// operation is ExecuteAtomicOperations or ExecuteExitOperations.
+type operation func(ctx context.Context, fb *flashbot.Client, config *configs.Config, eoa signer.Signer, chainID *big.Int, nonces *atomic.NonceManager, gasParams *atomic.GasParams) error
+
+// runZap executes the zap of config against chain through relay.
+func runZap(t *testing.T, chain *testchain.Chain, config *configs.Config) error {
+	t.Helper()
+	return run(t, chain, config, atomic.ExecuteAtomicOperations)
+}
+
+// run executes op with config against chain through the relay config submits to.
+func run(t *testing.T, chain *testchain.Chain, config *configs.Config, op operation) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	fb, err := flashbot.NewClient(config, chain.Client, chain.FlashbotsSigner())
+	if err != nil {
+		t.Fatalf("failed to create flashbots client: %v", err)
+	}
+	gasParams, err := atomic.CalculateDynamicGasParams(ctx, chain.Client, config.Gas)
+	if err != nil {
+		t.Fatalf("failed to calculate gas params: %v", err)
+	}
+	return op(ctx, fb, config, chain.EOASigner(), chain.ChainID, atomic.NewNonceManager(chain.Client, t.TempDir()), gasParams)
+}
+
+func TestZapLandsThroughRelay(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+
+	if n := relay.Calls("eth_sendBundle"); n != 1 {
+		t.Errorf("expected the bundle to land on the first submission, got %d submissions", n)
+	}
+	if !relay.SignedBy(crypto.PubkeyToAddress(chain.FlashbotsKey.PublicKey)) {
+		t.Error("relay requests were not signed with the Flashbots key")
+	}
+	if lp := chain.LPBalance(t, chain.EOA()); lp.Sign() <= 0 {
+		t.Errorf("expected LP tokens after the zap, got %s", lp)
+	}
+
+	// The swap output is sized to the pool ratio, so at most dust of the token is left over
+	swapped := new(big.Int).Div(testchain.InitialTokenReserve, big.NewInt(100))
+	if leftover := chain.TokenBalance(t, chain.EOA()); leftover.Cmp(swapped) >= 0 {
+		t.Errorf("expected the swapped tokens to be deposited, %s left over", leftover)
+	}
+
+	nonce, err := chain.Client.NonceAt(context.Background(), chain.EOA(), nil)
+	if err != nil {
+		t.Fatalf("failed to get nonce: %v", err)
+	}
+	if nonce != 3 {
+		t.Errorf("expected swap, approve and addLiquidity to be mined, account nonce is %d", nonce)
+	}
+}
+
+func TestZapSwapsAlongTheBestMultiHopPath(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	config.PathBaseTokens = []common.Address{testchain.WETHAddress, testchain.MidTokenAddress}
+	pool := testchain.PairAddress(testchain.TokenAddress, testchain.WETHAddress)
+	reserve := chain.TokenBalance(t, pool)
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+
+	if lp := chain.LPBalance(t, chain.EOA()); lp.Sign() <= 0 {
+		t.Errorf("expected LP tokens after the zap, got %s", lp)
+	}
+	// WETH → MID → TKN quotes twice the direct price, so the swap goes through the MID pool
+	midPool := testchain.PairAddress(testchain.MidTokenAddress, testchain.WETHAddress)
+	if weth := chain.BalanceOf(t, testchain.WETHAddress, midPool); weth.Cmp(testchain.InitialETHReserve) <= 0 {
+		t.Errorf("expected the swap to sell WETH into the MID pool, which holds %s wei", weth)
+	}
+	// The split is sized for the liquidity pool's price, so only the slippage margin of the
+	// swapped tokens is left out of the deposit
+	deposited := new(big.Int).Sub(chain.TokenBalance(t, pool), reserve)
+	if left := chain.TokenBalance(t, chain.EOA()); new(big.Int).Mul(left, big.NewInt(50)).Cmp(deposited) > 0 {
+		t.Errorf("expected the deposit to take the swapped tokens bar slippage, %s deposited and %s left", deposited, left)
+	}
+}
+
+func TestZapIntoFeeOnTransferToken(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	config.TokenAddress = testchain.FeeTokenAddress
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+
+	pool := testchain.PairAddress(testchain.FeeTokenAddress, testchain.WETHAddress)
+	if lp := chain.BalanceOf(t, pool, chain.EOA()); lp.Sign() <= 0 {
+		t.Errorf("expected LP tokens after the zap, got %s", lp)
+	}
+}
+
+func TestDryRunDoesNotSubmit(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	config.DryRun = true
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	if n := relay.Calls("eth_callBundle"); n != 1 {
+		t.Errorf("expected one simulation, got %d", n)
+	}
+	if n := relay.Calls("eth_sendBundle"); n != 0 {
+		t.Errorf("dry run submitted the bundle %d time(s)", n)
+	}
+	if lp := chain.LPBalance(t, chain.EOA()); lp.Sign() != 0 {
+		t.Errorf("dry run changed chain state: LP balance %s", lp)
+	}
+}
+
+func TestBribeIsPaidFromTheSimulatedSurplus(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	config.BribePercent = 50
+
+	if err := runZap(t, chain, config); err != nil {
+		t.Fatalf("zap failed: %v", err)
+	}
+
+	block, err := chain.Client.BlockByNumber(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to get block: %v", err)
+	}
+	var bribe *types.Transaction
+	for _, tx := range block.Transactions() {
+		if tx.To() == nil {
+			bribe = tx
+		}
+	}
+	if bribe == nil || bribe.Value().Sign() <= 0 {
+		t.Fatal("expected the bundle to end with a coinbase payment")
+	}
+	// Half of the surplus over a 1% slippage floor stays below 1% of the ETH swapped
+	if limit := new(big.Int).Div(config.EthAmount, big.NewInt(100)); bribe.Value().Cmp(limit) >= 0 {
+		t.Errorf("bribe of %s wei exceeds the slippage headroom %s", bribe.Value(), limit)
+	}
+}
+
+func TestBribeAboveTheSurplusRevertsTheSwap(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	config := chain.Config(relay.URL, big.NewInt(params.Ether))
+	config.CoinbaseBribe = new(big.Int).Div(config.EthAmount, big.NewInt(10))
+
+	if err := runZap(t, chain, config); err == nil {
+		t.Fatal("expected the guarded swap to fail the bundle")
+	}
+	if n := relay.Calls("eth_sendBundle"); n != 0 {
+		t.Errorf("submitted a bundle whose swap cannot pay the bribe %d time(s)", n)
+	}
+	if lp := chain.LPBalance(t, chain.EOA()); lp.Sign() != 0 {
+		t.Errorf("zap landed despite the bribe exceeding its surplus: LP balance %s", lp)
+	}
+}
@@ -1,10 +1,11 @@
 package configs
 
 import (
+	"flag"
 	"fmt"
 	"math/big"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -17,14 +18,46 @@ const (
 	FLASHBOTS_RELAY_URL = "https://relay.flashbots.net"
 
 	// -- Contract Addresses (Mainnet) --
-	UNISWAP_V2_ROUTER_ADDR = "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"
-	WETH_ADDRESS           = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"
+	UNISWAP_V2_ROUTER_ADDR           = "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"
+	UNISWAP_V2_FACTORY_ADDR          = "0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"
+	UNISWAP_V3_ROUTER_ADDR           = "0xE592427A0AEce92De3Edee1F18E0157C05861564"
+	UNISWAP_V3_FACTORY_ADDR          = "0x1F98431c8aD98523631AE4a59f267346ea31F984"
+	UNISWAP_V3_QUOTER_V2_ADDR        = "0x61fFE014bA17989E743c5F6cB21bF9697530B21e"
+	UNISWAP_V3_POSITION_MANAGER_ADDR = "0xC36442b4a4522E871399CD717aBDD847B20aCF7a"
+	WETH_ADDRESS                     = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"
+	USDC_ADDRESS                     = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	USDT_ADDRESS                     = "0xdAC17F958D2ee523a2206206994597C13D831ec7"
+	DAI_ADDRESS                      = "0x6B175474E89094C44Da98b954EedeAC495271d0F"
 
 	// -- Default Parameters --
 	DEFAULT_ETH_AMOUNT       = "0.002" // ETH to swap
 	DEFAULT_TOKEN_ADDRESS    = "0xF7285d17dded63A4480A0f1F0a8cc706F02dDa0a"
-	DEFAULT_SLIPPAGE         = 0.01 // 1%
-	DEFAULT_DEADLINE_SECONDS = 120  // 2 minutes
+	DEFAULT_SLIPPAGE         = 0.01        // 1%
+	DEFAULT_DEADLINE_SECONDS = 120         // 2 minutes
+	DEFAULT_BLOCK_WINDOW     = 5           // number of consecutive blocks a bundle is resubmitted for
+	DEFAULT_REQUOTE_BPS      = 50          // pool move, in basis points, that requotes a submitted bundle
+	DEFAULT_RELAYS           = "flashbots" // comma-separated names from KnownRelays or relay URLs
+	DEFAULT_CONFIG_FILE      = "config.yaml"
+	DEFAULT_FLASHBOTS_KEY    = "flashbots-key.json" // reputation key created next to the config file
+	MAX_SLIPPAGE             = 0.5
+	DUST_ETH_AMOUNT          = "0.0001" // smallest ETH amount worth zapping
+
+	// -- Operations --
+	OPERATION_ZAP  = "zap"  // ETH → token → LP
+	OPERATION_EXIT = "exit" // LP → token + ETH → ETH
+
+	// -- DEXes --
+	DEX_UNISWAP_V2      = "uniswap-v2"
+	DEX_SUSHISWAP       = "sushiswap"
+	DEX_PANCAKESWAP     = "pancakeswap"
+	DEX_UNISWAP_V3      = "uniswap-v3"
+	DEFAULT_V3_FEE_TIER = 3000 // 0.3% pool
+
+	// -- Submission Modes --
+	SUBMISSION_MODE_BUNDLE           = "bundle"    // eth_sendBundle, resubmitted per block
+	SUBMISSION_MODE_MEV_SHARE        = "mev-share" // mev_sendBundle with refund and privacy hints
+	DEFAULT_MEV_SHARE_REFUND_PERCENT = 90
+	DEFAULT_MEV_SHARE_HINTS          = "hash,contract_address,function_selector,logs"
 
 	// -- Dynamic Gas Parameters --
 	PRIORITY_FEE_MULTIPLIER  = 3.0  // 3x current priority fee for fast inclusion
@@ -32,8 +65,34 @@ const (
 	GAS_LIMIT_BUFFER_PERCENT = 30   // 30% buffer on gas estimates
 	MIN_PRIORITY_FEE_GWEI    = 2.0  // Minimum 2 Gwei priority fee
 	MAX_PRIORITY_FEE_GWEI    = 50.0 // Maximum 50 Gwei priority fee
+	BRIBE_PRIORITY_FEE_GWEI  = 0.1  // Priority fee of the other legs when a coinbase bribe pays for inclusion
 )
 
+// ZeroResetTokens revert when an allowance is changed from one non-zero value to another, so it
+// has to be set to zero first. Other such tokens are detected by simulating the approve.
+var ZeroResetTokens = []string{USDT_ADDRESS}
+
+// V2Deployment is a Uniswap V2 fork sharing the V2 router and factory ABIs.
+type V2Deployment struct {
+	Router  string
+	Factory string
+}
+
+// KnownV2Dexes maps DEX/--dex names to their mainnet deployments.
+var KnownV2Dexes = map[string]V2Deployment{
+	DEX_UNISWAP_V2:  {Router: UNISWAP_V2_ROUTER_ADDR, Factory: UNISWAP_V2_FACTORY_ADDR},
+	DEX_SUSHISWAP:   {Router: "0xd9e1cE17f2641f24aE83637ab66a2cca9C378B9F", Factory: "0xC0AEe478e3658e2610c5F7A4A2E1777cE9e4f2Ac"},
+	DEX_PANCAKESWAP: {Router: "0xEfF92A263d31888d860bD50809A8D171709b7b1c", Factory: "0x1097053Fd2ea711dad45caCcc45EfF7548fCB362"},
+}
+
+// KnownRelays maps builder names accepted in RELAYS/--relays to their eth_sendBundle endpoints.
+var KnownRelays = map[string]string{
+	"flashbots":   FLASHBOTS_RELAY_URL,
+	"beaverbuild": "https://rpc.beaverbuild.org",
+	"titan":       "https://rpc.titanbuilder.xyz",
+	"rsync":       "https://rsync-builder.xyz",
+}
+
 // Contract ABIs
 const (
 	RouterABI = `[
@@ -59,6 +118,57 @@ const (
 			"stateMutability": "payable",
 			"type": "function"
 		},
+		{
+			"inputs": [
+				{"internalType": "uint256", "name": "amountOutMin", "type": "uint256"},
+				{"internalType": "address[]", "name": "path", "type": "address[]"},
+				{"internalType": "address", "name": "to", "type": "address"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+			],
+			"name": "swapExactETHForTokensSupportingFeeOnTransferTokens",
+			"outputs": [],
+			"stateMutability": "payable",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "uint256", "name": "amountIn", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountOutMin", "type": "uint256"},
+				{"internalType": "address[]", "name": "path", "type": "address[]"},
+				{"internalType": "address", "name": "to", "type": "address"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+			],
+			"name": "swapExactTokensForTokens",
+			"outputs": [{"internalType": "uint256[]", "name": "amounts", "type": "uint256[]"}],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "uint256", "name": "amountIn", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountOutMin", "type": "uint256"},
+				{"internalType": "address[]", "name": "path", "type": "address[]"},
+				{"internalType": "address", "name": "to", "type": "address"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+			],
+			"name": "swapExactTokensForTokensSupportingFeeOnTransferTokens",
+			"outputs": [],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "uint256", "name": "amountIn", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountOutMin", "type": "uint256"},
+				{"internalType": "address[]", "name": "path", "type": "address[]"},
+				{"internalType": "address", "name": "to", "type": "address"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+			],
+			"name": "swapExactTokensForETHSupportingFeeOnTransferTokens",
+			"outputs": [],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		},
 		{
 			"inputs": [
 				{"internalType": "address", "name": "token", "type": "address"},
@@ -77,6 +187,52 @@ const (
 			"stateMutability": "payable",
 			"type": "function"
 		},
+		{
+			"inputs": [
+				{"internalType": "address", "name": "token", "type": "address"},
+				{"internalType": "uint256", "name": "liquidity", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountTokenMin", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountETHMin", "type": "uint256"},
+				{"internalType": "address", "name": "to", "type": "address"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+			],
+			"name": "removeLiquidityETH",
+			"outputs": [
+				{"internalType": "uint256", "name": "amountToken", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountETH", "type": "uint256"}
+			],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "address", "name": "token", "type": "address"},
+				{"internalType": "uint256", "name": "liquidity", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountTokenMin", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountETHMin", "type": "uint256"},
+				{"internalType": "address", "name": "to", "type": "address"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+			],
+			"name": "removeLiquidityETHSupportingFeeOnTransferTokens",
+			"outputs": [
+				{"internalType": "uint256", "name": "amountETH", "type": "uint256"}
+			],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "uint256", "name": "amountIn", "type": "uint256"},
+				{"internalType": "uint256", "name": "amountOutMin", "type": "uint256"},
+				{"internalType": "address[]", "name": "path", "type": "address[]"},
+				{"internalType": "address", "name": "to", "type": "address"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+			],
+			"name": "swapExactTokensForETH",
+			"outputs": [{"internalType": "uint256[]", "name": "amounts", "type": "uint256[]"}],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		},
 		{
 			"inputs": [],
 			"name": "factory",
@@ -96,27 +252,360 @@ const (
 			"outputs": [{"internalType": "bool", "name": "", "type": "bool"}],
 			"stateMutability": "nonpayable",
 			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "decimals",
+			"outputs": [{"internalType": "uint8", "name": "", "type": "uint8"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "symbol",
+			"outputs": [{"internalType": "string", "name": "", "type": "string"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "name",
+			"outputs": [{"internalType": "string", "name": "", "type": "string"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [{"internalType": "address", "name": "account", "type": "address"}],
+			"name": "balanceOf",
+			"outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "address", "name": "owner", "type": "address"},
+				{"internalType": "address", "name": "spender", "type": "address"}
+			],
+			"name": "allowance",
+			"outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "address", "name": "owner", "type": "address"},
+				{"internalType": "address", "name": "spender", "type": "address"},
+				{"internalType": "uint256", "name": "value", "type": "uint256"},
+				{"internalType": "uint256", "name": "deadline", "type": "uint256"},
+				{"internalType": "uint8", "name": "v", "type": "uint8"},
+				{"internalType": "bytes32", "name": "r", "type": "bytes32"},
+				{"internalType": "bytes32", "name": "s", "type": "bytes32"}
+			],
+			"name": "permit",
+			"outputs": [],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		},
+		{
+			"inputs": [{"internalType": "address", "name": "owner", "type": "address"}],
+			"name": "nonces",
+			"outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "DOMAIN_SEPARATOR",
+			"outputs": [{"internalType": "bytes32", "name": "", "type": "bytes32"}],
+			"stateMutability": "view",
+			"type": "function"
 		}
 	]`
-)
 
+	FactoryABI = `[
+		{
+			"inputs": [
+				{"internalType": "address", "name": "tokenA", "type": "address"},
+				{"internalType": "address", "name": "tokenB", "type": "address"}
+			],
+			"name": "getPair",
+			"outputs": [{"internalType": "address", "name": "pair", "type": "address"}],
+			"stateMutability": "view",
+			"type": "function"
+		}
+	]`
+
+	PairABI = `[
+		{
+			"inputs": [],
+			"name": "getReserves",
+			"outputs": [
+				{"internalType": "uint112", "name": "_reserve0", "type": "uint112"},
+				{"internalType": "uint112", "name": "_reserve1", "type": "uint112"},
+				{"internalType": "uint32", "name": "_blockTimestampLast", "type": "uint32"}
+			],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "token0",
+			"outputs": [{"internalType": "address", "name": "", "type": "address"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "totalSupply",
+			"outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [{"internalType": "address", "name": "owner", "type": "address"}],
+			"name": "balanceOf",
+			"outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}],
+			"stateMutability": "view",
+			"type": "function"
+		}
+	]`
+
+	V3FactoryABI = `[
+		{
+			"inputs": [
+				{"internalType": "address", "name": "tokenA", "type": "address"},
+				{"internalType": "address", "name": "tokenB", "type": "address"},
+				{"internalType": "uint24", "name": "fee", "type": "uint24"}
+			],
+			"name": "getPool",
+			"outputs": [{"internalType": "address", "name": "pool", "type": "address"}],
+			"stateMutability": "view",
+			"type": "function"
+		}
+	]`
+
+	V3PoolABI = `[
+		{
+			"inputs": [],
+			"name": "slot0",
+			"outputs": [
+				{"internalType": "uint160", "name": "sqrtPriceX96", "type": "uint160"},
+				{"internalType": "int24", "name": "tick", "type": "int24"},
+				{"internalType": "uint16", "name": "observationIndex", "type": "uint16"},
+				{"internalType": "uint16", "name": "observationCardinality", "type": "uint16"},
+				{"internalType": "uint16", "name": "observationCardinalityNext", "type": "uint16"},
+				{"internalType": "uint8", "name": "feeProtocol", "type": "uint8"},
+				{"internalType": "bool", "name": "unlocked", "type": "bool"}
+			],
+			"stateMutability": "view",
+			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "token0",
+			"outputs": [{"internalType": "address", "name": "", "type": "address"}],
+			"stateMutability": "view",
+			"type": "function"
+		}
+	]`
+
+	QuoterV2ABI = `[
+		{
+			"inputs": [
+				{"internalType": "bytes", "name": "path", "type": "bytes"},
+				{"internalType": "uint256", "name": "amountIn", "type": "uint256"}
+			],
+			"name": "quoteExactInput",
+			"outputs": [
+				{"internalType": "uint256", "name": "amountOut", "type": "uint256"},
+				{"internalType": "uint160[]", "name": "sqrtPriceX96AfterList", "type": "uint160[]"},
+				{"internalType": "uint32[]", "name": "initializedTicksCrossedList", "type": "uint32[]"},
+				{"internalType": "uint256", "name": "gasEstimate", "type": "uint256"}
+			],
+			"stateMutability": "nonpayable",
+			"type": "function"
+		}
+	]`
+
+	V3SwapRouterABI = `[
+		{
+			"inputs": [
+				{
+					"components": [
+						{"internalType": "bytes", "name": "path", "type": "bytes"},
+						{"internalType": "address", "name": "recipient", "type": "address"},
+						{"internalType": "uint256", "name": "deadline", "type": "uint256"},
+						{"internalType": "uint256", "name": "amountIn", "type": "uint256"},
+						{"internalType": "uint256", "name": "amountOutMinimum", "type": "uint256"}
+					],
+					"internalType": "struct ISwapRouter.ExactInputParams",
+					"name": "params",
+					"type": "tuple"
+				}
+			],
+			"name": "exactInput",
+			"outputs": [{"internalType": "uint256", "name": "amountOut", "type": "uint256"}],
+			"stateMutability": "payable",
+			"type": "function"
+		},
+		{
+			"inputs": [
+				{"internalType": "uint256", "name": "amountMinimum", "type": "uint256"},
+				{"internalType": "address", "name": "recipient", "type": "address"}
+			],
+			"name": "unwrapWETH9",
+			"outputs": [],
+			"stateMutability": "payable",
+			"type": "function"
+		},
+		{
+			"inputs": [{"internalType": "bytes[]", "name": "data", "type": "bytes[]"}],
+			"name": "multicall",
+			"outputs": [{"internalType": "bytes[]", "name": "results", "type": "bytes[]"}],
+			"stateMutability": "payable",
+			"type": "function"
+		}
+	]`
+
+	PositionManagerABI = `[
+		{
+			"inputs": [
+				{
+					"components": [
+						{"internalType": "address", "name": "token0", "type": "address"},
+						{"internalType": "address", "name": "token1", "type": "address"},
+						{"internalType": "uint24", "name": "fee", "type": "uint24"},
+						{"internalType": "int24", "name": "tickLower", "type": "int24"},
+						{"internalType": "int24", "name": "tickUpper", "type": "int24"},
+						{"internalType": "uint256", "name": "amount0Desired", "type": "uint256"},
+						{"internalType": "uint256", "name": "amount1Desired", "type": "uint256"},
+						{"internalType": "uint256", "name": "amount0Min", "type": "uint256"},
+						{"internalType": "uint256", "name": "amount1Min", "type": "uint256"},
+						{"internalType": "address", "name": "recipient", "type": "address"},
+						{"internalType": "uint256", "name": "deadline", "type": "uint256"}
+					],
+					"internalType": "struct INonfungiblePositionManager.MintParams",
+					"name": "params",
+					"type": "tuple"
+				}
+			],
+			"name": "mint",
+			"outputs": [
+				{"internalType": "uint256", "name": "tokenId", "type": "uint256"},
+				{"internalType": "uint128", "name": "liquidity", "type": "uint128"},
+				{"internalType": "uint256", "name": "amount0", "type": "uint256"},
+				{"internalType": "uint256", "name": "amount1", "type": "uint256"}
+			],
+			"stateMutability": "payable",
+			"type": "function"
+		},
+		{
+			"inputs": [],
+			"name": "refundETH",
+			"outputs": [],
+			"stateMutability": "payable",
+			"type": "function"
+		},
+		{
+			"inputs": [{"internalType": "bytes[]", "name": "data", "type": "bytes[]"}],
+			"name": "multicall",
+			"outputs": [{"internalType": "bytes[]", "name": "results", "type": "bytes[]"}],
+			"stateMutability": "payable",
+			"type": "function"
+		}
+	]`
+)
 
 type Config struct {
+	Network            string // name in Networks; its profile fills the endpoints and deployments not set otherwise
 	RpcURL             string
-	EoaPrivateKey      string
-	FlashbotsSignerKey string
+	RelayURL           string
+	EoaPrivateKey      string // plaintext key, development only
+	FlashbotsSignerKey string // plaintext key, development only
 	EthAmount          *big.Int
 	TokenAddress       common.Address
 	SlippageTolerance  float64
 	DeadlineSeconds    int64
+	BlockWindow        uint64
+	RequoteBps         uint64 // pool move in basis points past which a submitted bundle is requoted
+	Relays             []string
+	Operation          string
+	SubmissionMode     string
+	RefundPercent      int
+	MevShareHints      []string
+	CoinbaseBribe      *big.Int       // fixed wei paid to block.coinbase; nil or zero disables
+	BribePercent       float64        // share of the simulated swap surplus paid to block.coinbase
+	InputToken         common.Address // ERC-20 the zap is paid with; the zero address means ETH
+	InputAmount        *big.Int       // InputToken amount in its smallest unit
+	Dex                string
+	RouterAddress      common.Address // overrides the router of a V2 fork from KnownV2Dexes
+	FactoryAddress     common.Address // overrides the factory of a V2 fork from KnownV2Dexes
+	V3FeeTier          int64
+	V3TickLower        int64 // with V3TickUpper, the V3 position range; both zero means full range
+	V3TickUpper        int64
+	UsePermit          bool // grant allowances with an EIP-2612 permit where the token supports it
+	DryRun             bool // build and simulate the bundle without submitting it
+	Gas                GasTuning
+	ConfigFile         string // the config file that was loaded, if any
+
+	// Signers other than the development-only plaintext keys above
+	EoaKeystore           string         // go-ethereum keystore file of the trading account
+	EoaPasswordFile       string         // password of EoaKeystore; prompted for when empty
+	ExternalSigner        string         // clef-style signer endpoint, an IPC path or HTTP URL
+	EoaAddress            common.Address // trading account on ExternalSigner; optional if it has one account
+	FlashbotsKeystore     string         // keystore file of the Flashbots signing key
+	FlashbotsPasswordFile string         // password of FlashbotsKeystore; prompted for when empty
+	FlashbotsAddress      common.Address // Flashbots signing account on ExternalSigner
+
+	// Uniswap V3 deployment; the network profile fills the addresses left unset
+	V3Factory         common.Address
+	V3Router          common.Address // SwapRouter; SwapRouter02 takes no deadline and is not supported
+	V3Quoter          common.Address // QuoterV2
+	V3PositionManager common.Address // NonfungiblePositionManager
+
+	// Resolved from the network profile
+	ChainID        int64
+	WETHAddress    common.Address
+	PathBaseTokens []common.Address // intermediate hops tried when discovering swap paths
 }
 
+// PaysWithToken reports whether the zap is funded with an ERC-20 instead of ETH.
+func (c *Config) PaysWithToken() bool {
+	return c.InputToken != (common.Address{})
+}
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// NonceLockDir is where runs trading from the same account take their nonce lock: next to the
+// EOA keystore, else next to the config file, else the working directory.
+func (c *Config) NonceLockDir() string {
+	switch {
+	case c.EoaKeystore != "":
+		return filepath.Dir(c.EoaKeystore)
+	case c.ConfigFile != "":
+		return filepath.Dir(c.ConfigFile)
+	}
+	return "."
+}
+
+// GasTuning scales the fee and gas limit estimates. The defaults are the gas constants above.
+type GasTuning struct {
+	PriorityFeeMultiplier float64 // applied to the node's suggested priority fee
+	BaseFeeMultiplier     float64 // headroom of the fee cap over the current base fee
+	GasLimitBufferPercent uint64  // added on top of gas estimates
+	MinPriorityFeeGwei    float64
+	MaxPriorityFeeGwei    float64
+	BribePriorityFeeGwei  float64 // priority fee of the other legs when a coinbase bribe pays for inclusion
+}
+
+// DefaultGasTuning returns the built-in gas constants.
+func DefaultGasTuning() GasTuning {
+	return GasTuning{
+		PriorityFeeMultiplier: PRIORITY_FEE_MULTIPLIER,
+		BaseFeeMultiplier:     BASE_FEE_MULTIPLIER,
+		GasLimitBufferPercent: GAS_LIMIT_BUFFER_PERCENT,
+		MinPriorityFeeGwei:    MIN_PRIORITY_FEE_GWEI,
+		MaxPriorityFeeGwei:    MAX_PRIORITY_FEE_GWEI,
+		BribePriorityFeeGwei:  BRIBE_PRIORITY_FEE_GWEI,
 	}
-	return defaultValue
 }
 
 func parseEtherAmount(s string) (*big.Int, error) {
@@ -130,59 +619,181 @@ func parseEtherAmount(s string) (*big.Int, error) {
 	return wei, nil
 }
 
+// defaultConfig is the configuration before the file, environment and flags are applied. The
+// endpoints and the token are left to the network profile.
+func defaultConfig() *Config {
+	ethAmount, _ := parseEtherAmount(DEFAULT_ETH_AMOUNT)
+	return &Config{
+		Network:           DEFAULT_NETWORK,
+		EthAmount:         ethAmount,
+		SlippageTolerance: DEFAULT_SLIPPAGE,
+		DeadlineSeconds:   DEFAULT_DEADLINE_SECONDS,
+		BlockWindow:       DEFAULT_BLOCK_WINDOW,
+		RequoteBps:        DEFAULT_REQUOTE_BPS,
+		Relays:            strings.Split(DEFAULT_RELAYS, ","),
+		Operation:         OPERATION_ZAP,
+		SubmissionMode:    SUBMISSION_MODE_BUNDLE,
+		RefundPercent:     DEFAULT_MEV_SHARE_REFUND_PERCENT,
+		MevShareHints:     strings.Split(DEFAULT_MEV_SHARE_HINTS, ","),
+		Dex:               DEX_UNISWAP_V2,
+		V3FeeTier:         DEFAULT_V3_FEE_TIER,
+		Gas:               DefaultGasTuning(),
+	}
+}
+
+// ParseConfig reads the configuration from the command line, see Parse.
 func ParseConfig() (*Config, error) {
-	config := &Config{
-		RpcURL:             RPC_URL,
-		EoaPrivateKey:      getEnvOrDefault("EOA_PRIVATE_KEY", "YOUR_EOA_PRIVATE_KEY"),
-		FlashbotsSignerKey: getEnvOrDefault("FLASHBOTS_SIGNER_KEY", "YOUR_FLASHBOTS_SIGNER_KEY"),
-		TokenAddress:       common.HexToAddress(getEnvOrDefault("TOKEN_ADDRESS", DEFAULT_TOKEN_ADDRESS)),
-		SlippageTolerance:  DEFAULT_SLIPPAGE,
-		DeadlineSeconds:    DEFAULT_DEADLINE_SECONDS,
-	}
-
-	// Parse ETH amount
-	ethAmountStr := getEnvOrDefault("ETH_AMOUNT", DEFAULT_ETH_AMOUNT)
-	ethAmount, err := parseEtherAmount(ethAmountStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid ETH amount: %v", err)
-	}
-	config.EthAmount = ethAmount
-
-	// Parse slippage if provided
-	if slippageStr := os.Getenv("SLIPPAGE"); slippageStr != "" {
-		slippage, err := strconv.ParseFloat(slippageStr, 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid slippage: %v", err)
+	return Parse(os.Args[1:])
+}
+
+// Parse builds the configuration from the defaults, the YAML config file, the environment and
+// the command-line args, each overriding the previous one, fills what is still unset from the
+// network profile and validates the result. The file is --config, CONFIG_FILE or
+// DEFAULT_CONFIG_FILE when present. --help returns flag.ErrHelp after printing the usage.
+func Parse(args []string) (*Config, error) {
+	config := defaultConfig()
+
+	flags := flag.NewFlagSet("atomic_tx_bot", flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML config file (env CONFIG_FILE, default "+DEFAULT_CONFIG_FILE+" if present)")
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		flags.Var(&flagValue{setting: s, values: flagValues}, s.flag, s.usage+" (env "+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	// Config file
+	path, required := *configFile, true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path, required = DEFAULT_CONFIG_FILE, false
+	}
+	if err := loadConfigFile(config, path, required); err != nil {
+		return nil, err
+	}
+
+	// Environment
+	for _, s := range settings {
+		if value := os.Getenv(s.env); value != "" {
+			if err := s.set(config, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", s.env, err)
+			}
 		}
-		config.SlippageTolerance = slippage
 	}
 
-	// Parse deadline if provided
-	if deadlineStr := os.Getenv("DEADLINE_SECONDS"); deadlineStr != "" {
-		deadline, err := strconv.ParseInt(deadlineStr, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid deadline: %v", err)
+	// Command line
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		value, ok := flagValues[f.Name]
+		if !ok || flagErr != nil {
+			return
 		}
-		config.DeadlineSeconds = deadline
-	}
-
-	// Parse command line arguments
-	for i, arg := range os.Args[1:] {
-		if strings.HasPrefix(arg, "--eoa-key=") {
-			config.EoaPrivateKey = strings.TrimPrefix(arg, "--eoa-key=")
-		} else if strings.HasPrefix(arg, "--flashbots-key=") {
-			config.FlashbotsSignerKey = strings.TrimPrefix(arg, "--flashbots-key=")
-		} else if strings.HasPrefix(arg, "--token=") {
-			config.TokenAddress = common.HexToAddress(strings.TrimPrefix(arg, "--token="))
-		} else if strings.HasPrefix(arg, "--eth-amount=") {
-			ethAmountStr := strings.TrimPrefix(arg, "--eth-amount=")
-			ethAmount, err := parseEtherAmount(ethAmountStr)
-			if err != nil {
-				return nil, fmt.Errorf("invalid ETH amount in arg %d: %v", i+1, err)
-			}
-			config.EthAmount = ethAmount
+		if err := lookupSetting(f.Name).set(config, value); err != nil {
+			flagErr = fmt.Errorf("invalid --%s: %v", f.Name, err)
 		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
 	}
 
+	if err := config.applyNetwork(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	return config, nil
-}
\ No newline at end of file
+}
+
+// Validate checks the settings against each other and against sane bounds.
+func (c *Config) Validate() error {
+	if c.Operation != OPERATION_ZAP && c.Operation != OPERATION_EXIT {
+		return fmt.Errorf("invalid operation %q (want %q or %q)", c.Operation, OPERATION_ZAP, OPERATION_EXIT)
+	}
+	if c.SubmissionMode != SUBMISSION_MODE_BUNDLE && c.SubmissionMode != SUBMISSION_MODE_MEV_SHARE {
+		return fmt.Errorf("invalid submission mode %q (want %q or %q)", c.SubmissionMode, SUBMISSION_MODE_BUNDLE, SUBMISSION_MODE_MEV_SHARE)
+	}
+	if _, ok := KnownV2Dexes[c.Dex]; !ok && c.Dex != DEX_UNISWAP_V3 {
+		return fmt.Errorf("unknown DEX %q", c.Dex)
+	}
+	if err := c.validateNetwork(); err != nil {
+		return err
+	}
+	if c.EoaKeystore != "" && c.EoaPrivateKey != "" {
+		return fmt.Errorf("set either an EOA keystore or an EOA key, not both")
+	}
+	if c.FlashbotsKeystore != "" && c.FlashbotsSignerKey != "" {
+		return fmt.Errorf("set either a Flashbots keystore or a Flashbots key, not both")
+	}
+	if (c.EoaAddress != (common.Address{}) || c.FlashbotsAddress != (common.Address{})) && c.ExternalSigner == "" {
+		return fmt.Errorf("signer account addresses require an external signer")
+	}
+	if c.Dex == DEX_UNISWAP_V3 && (c.V3Factory == (common.Address{}) || c.V3Router == (common.Address{}) ||
+		c.V3Quoter == (common.Address{}) || c.V3PositionManager == (common.Address{})) {
+		return fmt.Errorf("%s has no known Uniswap V3 deployment, set v3-factory, v3-router, v3-quoter and v3-position-manager", c.Network)
+	}
+	if c.Dex == DEX_UNISWAP_V3 && c.Operation == OPERATION_EXIT {
+		return fmt.Errorf("the %s operation needs a V2 pair's LP token and is not supported on %s", OPERATION_EXIT, DEX_UNISWAP_V3)
+	}
+	if c.V3TickLower > c.V3TickUpper {
+		return fmt.Errorf("V3 tick range [%d, %d] is empty", c.V3TickLower, c.V3TickUpper)
+	}
+	if c.TokenAddress == (common.Address{}) {
+		return fmt.Errorf("token address is required")
+	}
+	if c.SlippageTolerance < 0 || c.SlippageTolerance > MAX_SLIPPAGE {
+		return fmt.Errorf("slippage %g is outside [0, %g]", c.SlippageTolerance, MAX_SLIPPAGE)
+	}
+	if c.DeadlineSeconds <= 0 {
+		return fmt.Errorf("deadline must be positive, got %d seconds", c.DeadlineSeconds)
+	}
+	if c.BlockWindow == 0 {
+		return fmt.Errorf("block window must be at least one block")
+	}
+	if c.RequoteBps > 10000 {
+		return fmt.Errorf("requote threshold %d bps is above 10000", c.RequoteBps)
+	}
+	if c.RefundPercent < 0 || c.RefundPercent > 100 {
+		return fmt.Errorf("refund percent %d is outside [0, 100]", c.RefundPercent)
+	}
+	if c.BribePercent < 0 || c.BribePercent > 100 {
+		return fmt.Errorf("bribe percent %g is outside [0, 100]", c.BribePercent)
+	}
+	if c.CoinbaseBribe != nil && c.CoinbaseBribe.Sign() < 0 {
+		return fmt.Errorf("coinbase bribe must not be negative")
+	}
+
+	if c.Operation == OPERATION_ZAP {
+		if c.PaysWithToken() {
+			if c.InputAmount == nil || c.InputAmount.Sign() <= 0 {
+				return fmt.Errorf("INPUT_AMOUNT is required when INPUT_TOKEN is set")
+			}
+		} else {
+			dust, _ := parseEtherAmount(DUST_ETH_AMOUNT)
+			if c.EthAmount == nil || c.EthAmount.Cmp(dust) < 0 {
+				return fmt.Errorf("ETH amount is below the dust threshold of %s ETH", DUST_ETH_AMOUNT)
+			}
+		}
+	}
+
+	gas := c.Gas
+	if gas.PriorityFeeMultiplier <= 0 {
+		return fmt.Errorf("priority fee multiplier must be positive, got %g", gas.PriorityFeeMultiplier)
+	}
+	if gas.BaseFeeMultiplier < 1 {
+		return fmt.Errorf("base fee multiplier must be at least 1, got %g", gas.BaseFeeMultiplier)
+	}
+	if gas.MinPriorityFeeGwei < 0 || gas.MinPriorityFeeGwei > gas.MaxPriorityFeeGwei {
+		return fmt.Errorf("priority fee bounds [%g, %g] Gwei are invalid", gas.MinPriorityFeeGwei, gas.MaxPriorityFeeGwei)
+	}
+	if gas.BribePriorityFeeGwei < 0 {
+		return fmt.Errorf("bribe priority fee must not be negative, got %g", gas.BribePriorityFeeGwei)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package configs
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestParsePrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+rpc_url: http://file:8545
+slippage: 0.02
+deadline: 300
+relays: [flashbots, titan]
+priority_fee_multiplier: 1.5
+`)
+	t.Setenv("SLIPPAGE", "0.03")
+
+	config, err := Parse([]string{"--config", path, "--deadline=60", "--dry-run"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if config.RpcURL != "http://file:8545" {
+		t.Errorf("file value not applied: rpc url %q", config.RpcURL)
+	}
+	if config.SlippageTolerance != 0.03 {
+		t.Errorf("environment should override the file: slippage %g", config.SlippageTolerance)
+	}
+	if config.DeadlineSeconds != 60 {
+		t.Errorf("flags should override the file: deadline %d", config.DeadlineSeconds)
+	}
+	if strings.Join(config.Relays, ",") != "flashbots,titan" {
+		t.Errorf("file list not applied: relays %v", config.Relays)
+	}
+	if config.Gas.PriorityFeeMultiplier != 1.5 || config.Gas.BaseFeeMultiplier != BASE_FEE_MULTIPLIER {
+		t.Errorf("gas tuning not applied: %+v", config.Gas)
+	}
+	if !config.DryRun || config.ConfigFile != path {
+		t.Errorf("dry run %v, config file %q", config.DryRun, config.ConfigFile)
+	}
+}
+
+func TestParseRejectsInvalidSettings(t *testing.T) {
+	for name, tc := range map[string]struct {
+		file string
+		args []string
+		want string
+	}{
+		"unknown file key":   {file: "slipage: 0.1\n", want: `unknown key "slipage"`},
+		"unknown flag":       {args: []string{"--slipage=0.1"}, want: "flag provided but not defined"},
+		"bad checksum":       {args: []string{"--token=0xf7285d17dded63A4480A0f1F0a8cc706F02dDa0a"}, want: "bad checksum"},
+		"slippage too high":  {args: []string{"--slippage=0.6"}, want: "slippage"},
+		"negative slippage":  {args: []string{"--slippage=-0.01"}, want: "slippage"},
+		"zero deadline":      {args: []string{"--deadline=0"}, want: "deadline must be positive"},
+		"requote above 100%": {args: []string{"--requote-bps=10001"}, want: "requote threshold"},
+		"dust amount":        {args: []string{"--eth-amount=0.00001"}, want: "dust"},
+		"low fee multiplier": {args: []string{"--base-fee-multiplier=0.5"}, want: "base fee multiplier"},
+		"keystore and key":   {args: []string{"--eoa-keystore=eoa.json", "--eoa-key=0x01"}, want: "not both"},
+		"address no signer":  {args: []string{"--eoa-address=" + DEFAULT_TOKEN_ADDRESS}, want: "require an external signer"},
+		"unknown network":    {args: []string{"--network=goerli"}, want: `unknown network "goerli"`},
+		"v3 exit":            {args: []string{"--dex=uniswap-v3", "--operation=exit"}, want: "not supported on uniswap-v3"},
+		"testnet v3":         {args: []string{"--network=sepolia", "--token=" + DEFAULT_TOKEN_ADDRESS, "--dex=uniswap-v3"}, want: "no known Uniswap V3 deployment"},
+		"testnet fork":       {args: []string{"--network=sepolia", "--token=" + DEFAULT_TOKEN_ADDRESS, "--dex=sushiswap"}, want: "only available on mainnet"},
+		"testnet builder":    {args: []string{"--network=sepolia", "--token=" + DEFAULT_TOKEN_ADDRESS, "--relays=flashbots,titan"}, want: `relay "titan"`},
+		"testnet token":      {args: []string{"--network=sepolia"}, want: "token address is required"},
+		"no holesky router":  {args: []string{"--network=holesky", "--token=" + DEFAULT_TOKEN_ADDRESS}, want: "no known Uniswap V2 deployment"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"--config", writeConfigFile(t, tc.file)}, args...)
+			}
+			_, err := Parse(args)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestParseAddressAcceptsUnchecksummedCase(t *testing.T) {
+	for _, s := range []string{DEFAULT_TOKEN_ADDRESS, strings.ToLower(DEFAULT_TOKEN_ADDRESS)} {
+		if _, err := ParseAddress(s); err != nil {
+			t.Errorf("ParseAddress(%s): %v", s, err)
+		}
+	}
+}
+
+func TestNetworkProfileFillsUnsetSettings(t *testing.T) {
+	config, err := Parse(nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if config.Network != NETWORK_MAINNET || config.RpcURL != RPC_URL || config.TokenAddress.Hex() != DEFAULT_TOKEN_ADDRESS {
+		t.Errorf("mainnet defaults not applied: network %q, rpc url %q, token %s", config.Network, config.RpcURL, config.TokenAddress.Hex())
+	}
+	if config.RouterAddress != (common.Address{}) || len(config.PathBaseTokens) != 4 {
+		t.Errorf("mainnet should keep the KnownV2Dexes deployments: router %s, %d base tokens", config.RouterAddress.Hex(), len(config.PathBaseTokens))
+	}
+	if config.V3Router != common.HexToAddress(UNISWAP_V3_ROUTER_ADDR) || config.V3PositionManager != common.HexToAddress(UNISWAP_V3_POSITION_MANAGER_ADDR) {
+		t.Errorf("mainnet Uniswap V3 deployment not applied: router %s, position manager %s", config.V3Router.Hex(), config.V3PositionManager.Hex())
+	}
+
+	sepolia := Networks[NETWORK_SEPOLIA]
+	config, err = Parse([]string{"--network=sepolia", "--token=" + DEFAULT_TOKEN_ADDRESS, "--rpc-url=http://localhost:8545"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if config.RpcURL != "http://localhost:8545" || config.RelayURL != sepolia.RelayURL {
+		t.Errorf("explicit settings should win over the profile: rpc url %q, relay url %q", config.RpcURL, config.RelayURL)
+	}
+	if config.ChainID != sepolia.ChainID || config.WETHAddress.Hex() != sepolia.WETH || config.RouterAddress.Hex() != sepolia.Router {
+		t.Errorf("sepolia profile not applied: chain %d, WETH %s, router %s", config.ChainID, config.WETHAddress.Hex(), config.RouterAddress.Hex())
+	}
+}
+
+// Router and factory may be empty for chains without a canonical Uniswap V2 deployment, but
+// never just one of them.
+func TestNetworkProfilesAreComplete(t *testing.T) {
+	for name, network := range Networks {
+		for field, value := range map[string]string{"rpc url": network.RpcURL, "relay url": network.RelayURL, "WETH": network.WETH} {
+			if value == "" {
+				t.Errorf("network %s has no %s", name, field)
+			}
+		}
+		if (network.Router == "") != (network.Factory == "") {
+			t.Errorf("network %s has only half a Uniswap V2 deployment", name)
+		}
+		if network.ChainID == 0 || len(network.BaseTokens) == 0 {
+			t.Errorf("network %s has no chain ID or base tokens", name)
+		}
+	}
+}
+
+func TestCheckChainID(t *testing.T) {
+	config := &Config{Network: NETWORK_MAINNET, ChainID: 1}
+	if err := config.CheckChainID(big.NewInt(1)); err != nil {
+		t.Errorf("matching chain rejected: %v", err)
+	}
+	if err := config.CheckChainID(big.NewInt(11155111)); err == nil {
+		t.Error("expected a Sepolia endpoint to be rejected on mainnet")
+	}
+}
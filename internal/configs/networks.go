@@ -0,0 +1,161 @@
+package configs
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	NETWORK_MAINNET = "mainnet"
+	NETWORK_SEPOLIA = "sepolia"
+	NETWORK_HOLESKY = "holesky"
+	DEFAULT_NETWORK = NETWORK_MAINNET
+)
+
+// Network is a chain the bot can run on: its endpoints and the deployments the zap trades
+// against. Empty fields have no default on that chain and must be configured.
+type Network struct {
+	ChainID    int64
+	RpcURL     string
+	RelayURL   string
+	Router     string // Uniswap V2 router
+	Factory    string // Uniswap V2 factory
+	WETH       string
+	Token      string   // default token to zap into
+	BaseTokens []string // intermediate hops tried when discovering swap paths
+
+	V3Factory         string
+	V3Router          string // SwapRouter
+	V3Quoter          string // QuoterV2
+	V3PositionManager string // NonfungiblePositionManager
+}
+
+// Networks maps --network names to their profiles. Only mainnet has the other V2 forks and the
+// builders in KnownRelays.
+var Networks = map[string]Network{
+	NETWORK_MAINNET: {
+		ChainID:    1,
+		RpcURL:     RPC_URL,
+		RelayURL:   FLASHBOTS_RELAY_URL,
+		Router:     UNISWAP_V2_ROUTER_ADDR,
+		Factory:    UNISWAP_V2_FACTORY_ADDR,
+		WETH:       WETH_ADDRESS,
+		Token:      DEFAULT_TOKEN_ADDRESS,
+		BaseTokens: []string{WETH_ADDRESS, USDC_ADDRESS, USDT_ADDRESS, DAI_ADDRESS},
+
+		V3Factory:         UNISWAP_V3_FACTORY_ADDR,
+		V3Router:          UNISWAP_V3_ROUTER_ADDR,
+		V3Quoter:          UNISWAP_V3_QUOTER_V2_ADDR,
+		V3PositionManager: UNISWAP_V3_POSITION_MANAGER_ADDR,
+	},
+	// Sepolia's Uniswap V3 only deploys SwapRouter02, so V3 needs the v3-* settings there
+	NETWORK_SEPOLIA: {
+		ChainID:    11155111,
+		RpcURL:     "https://rpc.sepolia.org",
+		RelayURL:   "https://relay-sepolia.flashbots.net",
+		Router:     "0xeE567Fe1712Faf6149d80dA1E6934E354124CfE3",
+		Factory:    "0xF62c03E08ada871A0bEb309762E260a7a6a880E6",
+		WETH:       "0xfFf9976782d46CC05630D1f6eBAb18b2324d6B14",
+		BaseTokens: []string{"0xfFf9976782d46CC05630D1f6eBAb18b2324d6B14"},
+	},
+	// Holesky has no canonical Uniswap V2 deployment, so the router and factory must be configured
+	NETWORK_HOLESKY: {
+		ChainID:    17000,
+		RpcURL:     "https://ethereum-holesky-rpc.publicnode.com",
+		RelayURL:   "https://relay-holesky.flashbots.net",
+		WETH:       "0x94373a4919B3240D86eA41593D5eBa789FEF3848",
+		BaseTokens: []string{"0x94373a4919B3240D86eA41593D5eBa789FEF3848"},
+	},
+}
+
+// networkNames lists the known networks for error messages.
+func networkNames() string {
+	names := make([]string, 0, len(Networks))
+	for name := range Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyNetwork fills the settings left unset by every source from the profile of c.Network.
+// Off mainnet the DEX is the network's Uniswap V2 deployment, so its router and factory come
+// from the profile rather than from KnownV2Dexes.
+func (c *Config) applyNetwork() error {
+	network, ok := Networks[c.Network]
+	if !ok {
+		return fmt.Errorf("unknown network %q (want one of %s)", c.Network, networkNames())
+	}
+
+	if c.RpcURL == "" {
+		c.RpcURL = network.RpcURL
+	}
+	if c.RelayURL == "" {
+		c.RelayURL = network.RelayURL
+	}
+	if c.TokenAddress == (common.Address{}) && network.Token != "" {
+		c.TokenAddress = common.HexToAddress(network.Token)
+	}
+	if c.Network != NETWORK_MAINNET {
+		if c.RouterAddress == (common.Address{}) && network.Router != "" {
+			c.RouterAddress = common.HexToAddress(network.Router)
+		}
+		if c.FactoryAddress == (common.Address{}) && network.Factory != "" {
+			c.FactoryAddress = common.HexToAddress(network.Factory)
+		}
+	}
+
+	for _, v3 := range []struct {
+		address *common.Address
+		profile string
+	}{
+		{&c.V3Factory, network.V3Factory},
+		{&c.V3Router, network.V3Router},
+		{&c.V3Quoter, network.V3Quoter},
+		{&c.V3PositionManager, network.V3PositionManager},
+	} {
+		if *v3.address == (common.Address{}) && v3.profile != "" {
+			*v3.address = common.HexToAddress(v3.profile)
+		}
+	}
+
+	c.ChainID = network.ChainID
+	c.WETHAddress = common.HexToAddress(network.WETH)
+	c.PathBaseTokens = make([]common.Address, len(network.BaseTokens))
+	for i, token := range network.BaseTokens {
+		c.PathBaseTokens[i] = common.HexToAddress(token)
+	}
+	return nil
+}
+
+// validateNetwork rejects settings that only exist on mainnet when running elsewhere.
+func (c *Config) validateNetwork() error {
+	if c.Network == NETWORK_MAINNET {
+		return nil
+	}
+	if c.Dex != DEX_UNISWAP_V2 && c.Dex != DEX_UNISWAP_V3 {
+		return fmt.Errorf("DEX %q is only available on %s", c.Dex, NETWORK_MAINNET)
+	}
+	if c.Dex == DEX_UNISWAP_V2 && (c.RouterAddress == (common.Address{}) || c.FactoryAddress == (common.Address{})) {
+		return fmt.Errorf("%s has no known Uniswap V2 deployment, set the router and factory", c.Network)
+	}
+	for _, relay := range c.Relays {
+		if _, ok := KnownRelays[relay]; ok && relay != "flashbots" {
+			return fmt.Errorf("relay %q is only available on %s", relay, NETWORK_MAINNET)
+		}
+	}
+	return nil
+}
+
+// CheckChainID fails unless id, as reported by the RPC endpoint, is the chain of c.Network, so
+// that keys and router addresses meant for one chain are never used on another.
+func (c *Config) CheckChainID(id *big.Int) error {
+	if !id.IsInt64() || id.Int64() != c.ChainID {
+		return fmt.Errorf("RPC endpoint is on chain %s, but network %s is chain %d", id, c.Network, c.ChainID)
+	}
+	return nil
+}
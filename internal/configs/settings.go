@@ -0,0 +1,268 @@
+package configs
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v2"
+)
+
+// setting is one configuration value, settable from the config file, the environment and the
+// command line. Every source goes through the same parser.
+type setting struct {
+	flag   string // command-line flag, also the config file key with dashes as underscores
+	env    string
+	usage  string
+	isBool bool // flag that takes no value
+	set    func(c *Config, value string) error
+}
+
+// fileKey is the config file key of s.
+func (s setting) fileKey() string {
+	return strings.ReplaceAll(s.flag, "-", "_")
+}
+
+var settings = []setting{
+	{flag: "network", env: "NETWORK", usage: "network profile: mainnet, sepolia or holesky", set: stringSetting(func(c *Config) *string { return &c.Network })},
+	{flag: "rpc-url", env: "RPC_URL", usage: "Ethereum JSON-RPC endpoint", set: stringSetting(func(c *Config) *string { return &c.RpcURL })},
+	{flag: "relay-url", env: "FLASHBOTS_RELAY_URL", usage: "Flashbots relay endpoint", set: stringSetting(func(c *Config) *string { return &c.RelayURL })},
+	{flag: "eoa-keystore", env: "EOA_KEYSTORE", usage: "keystore file of the trading account", set: stringSetting(func(c *Config) *string { return &c.EoaKeystore })},
+	{flag: "eoa-password-file", env: "EOA_PASSWORD_FILE", usage: "password file of the EOA keystore, prompted for if unset", set: stringSetting(func(c *Config) *string { return &c.EoaPasswordFile })},
+	{flag: "external-signer", env: "EXTERNAL_SIGNER", usage: "clef IPC path or URL signing for the trading account", set: stringSetting(func(c *Config) *string { return &c.ExternalSigner })},
+	{flag: "eoa-address", env: "EOA_ADDRESS", usage: "trading account on the external signer", set: addressSetting(func(c *Config) *common.Address { return &c.EoaAddress })},
+	{flag: "flashbots-keystore", env: "FLASHBOTS_KEYSTORE", usage: "keystore file of the key signing relay requests, default " + DEFAULT_FLASHBOTS_KEY + " next to the config, created on first run", set: stringSetting(func(c *Config) *string { return &c.FlashbotsKeystore })},
+	{flag: "flashbots-password-file", env: "FLASHBOTS_PASSWORD_FILE", usage: "password file of the Flashbots keystore, prompted for if unset", set: stringSetting(func(c *Config) *string { return &c.FlashbotsPasswordFile })},
+	{flag: "flashbots-address", env: "FLASHBOTS_ADDRESS", usage: "account on the external signer signing relay requests", set: addressSetting(func(c *Config) *common.Address { return &c.FlashbotsAddress })},
+	{flag: "eoa-key", env: "EOA_PRIVATE_KEY", usage: "hex private key of the trading account (development only)", set: stringSetting(func(c *Config) *string { return &c.EoaPrivateKey })},
+	{flag: "flashbots-key", env: "FLASHBOTS_SIGNER_KEY", usage: "hex private key signing relay requests (development only)", set: stringSetting(func(c *Config) *string { return &c.FlashbotsSignerKey })},
+	{flag: "token", env: "TOKEN_ADDRESS", usage: "token paired with WETH", set: addressSetting(func(c *Config) *common.Address { return &c.TokenAddress })},
+	{flag: "eth-amount", env: "ETH_AMOUNT", usage: "ETH to zap", set: etherSetting(func(c *Config) **big.Int { return &c.EthAmount })},
+	{flag: "input-token", env: "INPUT_TOKEN", usage: "ERC-20 to pay the zap with instead of ETH", set: addressSetting(func(c *Config) *common.Address { return &c.InputToken })},
+	{flag: "input-amount", env: "INPUT_AMOUNT", usage: "input token amount in its smallest unit", set: func(c *Config, value string) error {
+		amount, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return fmt.Errorf("not an integer: %s", value)
+		}
+		c.InputAmount = amount
+		return nil
+	}},
+	{flag: "slippage", env: "SLIPPAGE", usage: "slippage tolerance as a fraction, 0 to 0.5", set: floatSetting(func(c *Config) *float64 { return &c.SlippageTolerance })},
+	{flag: "deadline", env: "DEADLINE_SECONDS", usage: "transaction deadline in seconds", set: intSetting(func(c *Config) *int64 { return &c.DeadlineSeconds })},
+	{flag: "block-window", env: "BLOCK_WINDOW", usage: "consecutive blocks a bundle is submitted for", set: uintSetting(func(c *Config) *uint64 { return &c.BlockWindow })},
+	{flag: "requote-bps", env: "REQUOTE_BPS", usage: "pool move in basis points that requotes a submitted bundle", set: uintSetting(func(c *Config) *uint64 { return &c.RequoteBps })},
+	{flag: "relays", env: "RELAYS", usage: "comma-separated relay names or URLs", set: listSetting(func(c *Config) *[]string { return &c.Relays })},
+	{flag: "operation", env: "OPERATION", usage: OPERATION_ZAP + " or " + OPERATION_EXIT, set: stringSetting(func(c *Config) *string { return &c.Operation })},
+	{flag: "mode", env: "SUBMISSION_MODE", usage: SUBMISSION_MODE_BUNDLE + " or " + SUBMISSION_MODE_MEV_SHARE, set: stringSetting(func(c *Config) *string { return &c.SubmissionMode })},
+	{flag: "refund-percent", env: "MEV_SHARE_REFUND_PERCENT", usage: "MEV-Share refund percent", set: func(c *Config, value string) error {
+		refund, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		c.RefundPercent = refund
+		return nil
+	}},
+	{flag: "mev-share-hints", env: "MEV_SHARE_HINTS", usage: "comma-separated MEV-Share privacy hints", set: listSetting(func(c *Config) *[]string { return &c.MevShareHints })},
+	{flag: "bribe-eth", env: "COINBASE_BRIBE_ETH", usage: "fixed ETH paid to block.coinbase; the swap reverts unless its surplus covers it", set: etherSetting(func(c *Config) **big.Int { return &c.CoinbaseBribe })},
+	{flag: "bribe-percent", env: "BRIBE_PROFIT_PERCENT", usage: "percent of the simulated swap surplus paid to block.coinbase", set: floatSetting(func(c *Config) *float64 { return &c.BribePercent })},
+	{flag: "dex", env: "DEX", usage: "uniswap-v2, sushiswap, pancakeswap or uniswap-v3", set: stringSetting(func(c *Config) *string { return &c.Dex })},
+	{flag: "router", env: "ROUTER_ADDRESS", usage: "V2 router override", set: addressSetting(func(c *Config) *common.Address { return &c.RouterAddress })},
+	{flag: "factory", env: "FACTORY_ADDRESS", usage: "V2 factory override", set: addressSetting(func(c *Config) *common.Address { return &c.FactoryAddress })},
+	{flag: "v3-factory", env: "V3_FACTORY_ADDRESS", usage: "Uniswap V3 factory override", set: addressSetting(func(c *Config) *common.Address { return &c.V3Factory })},
+	{flag: "v3-router", env: "V3_ROUTER_ADDRESS", usage: "Uniswap V3 SwapRouter override", set: addressSetting(func(c *Config) *common.Address { return &c.V3Router })},
+	{flag: "v3-quoter", env: "V3_QUOTER_ADDRESS", usage: "Uniswap V3 QuoterV2 override", set: addressSetting(func(c *Config) *common.Address { return &c.V3Quoter })},
+	{flag: "v3-position-manager", env: "V3_POSITION_MANAGER_ADDRESS", usage: "Uniswap V3 NonfungiblePositionManager override", set: addressSetting(func(c *Config) *common.Address { return &c.V3PositionManager })},
+	{flag: "v3-fee", env: "V3_FEE_TIER", usage: "V3 pool fee tier", set: intSetting(func(c *Config) *int64 { return &c.V3FeeTier })},
+	{flag: "v3-tick-lower", env: "V3_TICK_LOWER", usage: "V3 position lower tick", set: intSetting(func(c *Config) *int64 { return &c.V3TickLower })},
+	{flag: "v3-tick-upper", env: "V3_TICK_UPPER", usage: "V3 position upper tick", set: intSetting(func(c *Config) *int64 { return &c.V3TickUpper })},
+	{flag: "permit", env: "USE_PERMIT", usage: "grant allowances with EIP-2612 permits", isBool: true, set: boolSetting(func(c *Config) *bool { return &c.UsePermit })},
+	{flag: "dry-run", env: "DRY_RUN", usage: "simulate the bundle without sending it", isBool: true, set: boolSetting(func(c *Config) *bool { return &c.DryRun })},
+
+	// Gas tuning
+	{flag: "priority-fee-multiplier", env: "PRIORITY_FEE_MULTIPLIER", usage: "multiplier on the suggested priority fee", set: floatSetting(func(c *Config) *float64 { return &c.Gas.PriorityFeeMultiplier })},
+	{flag: "base-fee-multiplier", env: "BASE_FEE_MULTIPLIER", usage: "fee cap headroom over the base fee", set: floatSetting(func(c *Config) *float64 { return &c.Gas.BaseFeeMultiplier })},
+	{flag: "gas-limit-buffer-percent", env: "GAS_LIMIT_BUFFER_PERCENT", usage: "buffer added to gas estimates", set: uintSetting(func(c *Config) *uint64 { return &c.Gas.GasLimitBufferPercent })},
+	{flag: "min-priority-fee-gwei", env: "MIN_PRIORITY_FEE_GWEI", usage: "lower bound of the priority fee", set: floatSetting(func(c *Config) *float64 { return &c.Gas.MinPriorityFeeGwei })},
+	{flag: "max-priority-fee-gwei", env: "MAX_PRIORITY_FEE_GWEI", usage: "upper bound of the priority fee", set: floatSetting(func(c *Config) *float64 { return &c.Gas.MaxPriorityFeeGwei })},
+	{flag: "bribe-priority-fee-gwei", env: "BRIBE_PRIORITY_FEE_GWEI", usage: "priority fee of the other legs when bribing", set: floatSetting(func(c *Config) *float64 { return &c.Gas.BribePriorityFeeGwei })},
+}
+
+func lookupSetting(flag string) setting {
+	for _, s := range settings {
+		if s.flag == flag {
+			return s
+		}
+	}
+	panic("unknown setting " + flag)
+}
+
+// flagValue records a command-line value so that it can be applied after the file and the
+// environment.
+type flagValue struct {
+	setting setting
+	values  map[string]string
+}
+
+func (v *flagValue) String() string { return "" }
+
+func (v *flagValue) Set(value string) error {
+	v.values[v.setting.flag] = value
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.setting.isBool }
+
+// loadConfigFile applies the YAML file at path. Unknown keys are rejected so that typos do not
+// go unnoticed. A missing file is only an error when it was asked for explicitly.
+func loadConfigFile(config *Config, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var found *setting
+		for i := range settings {
+			if settings[i].fileKey() == key {
+				found = &settings[i]
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf("unknown key %q in config file %s", key, path)
+		}
+		if err := found.set(config, fileValue(values[key])); err != nil {
+			return fmt.Errorf("invalid %s in config file %s: %v", key, path, err)
+		}
+	}
+
+	config.ConfigFile = path
+	return nil
+}
+
+// fileValue renders a YAML scalar or list the way it would be written in the environment.
+func fileValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// ParseAddress parses a hex address. Mixed-case addresses must carry a valid EIP-55 checksum,
+// which catches mistyped characters; all-lowercase or all-uppercase addresses have none.
+func ParseAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("not a hex address: %s", s)
+	}
+	address := common.HexToAddress(s)
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && "0x"+digits != address.Hex() {
+		return common.Address{}, fmt.Errorf("bad checksum for %s (expected %s)", s, address.Hex())
+	}
+	return address, nil
+}
+
+func stringSetting(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func listSetting(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = strings.Split(value, ",")
+		return nil
+	}
+}
+
+func addressSetting(field func(c *Config) *common.Address) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		address, err := ParseAddress(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = address
+		return nil
+	}
+}
+
+func etherSetting(field func(c *Config) **big.Int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		amount, err := parseEtherAmount(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = amount
+		return nil
+	}
+}
+
+func floatSetting(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func intSetting(field func(c *Config) *int64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func uintSetting(field func(c *Config) *uint64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = u
+		return nil
+	}
+}
+
+func boolSetting(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
@@ -2,7 +2,7 @@ package flashbot
 import (
 	"bytes"
 	"context"
-	"crypto/ecdsa"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,48 +10,99 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 
 	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
 )
 
 
-func SimulateBundle(ctx context.Context, txs []*types.Transaction, authKey *ecdsa.PrivateKey) (*SimulationResponse, error) {
-	// Encode transactions
-	var txsHex []string
-	for i, tx := range txs {
-		rawTx, err := tx.MarshalBinary()
-		if err != nil {
-			return nil, fmt.Errorf("failed to encode transaction: %v", err)
-		}
-		log.Printf("TX %d len=%d firstByte=%#x", i+1, len(rawTx), rawTx[0])
+// Client submits bundles to the configured relays. It is built once from a Config and reuses
+// one Ethereum RPC connection and one HTTP client for every operation.
+type Client struct {
+	eth        *ethclient.Client
+	relayURL   string
+	relays     []Relay
+	httpClient *http.Client
+	auth       signer.Signer
+}
 
-		var chk types.Transaction
-		if err := chk.UnmarshalBinary(rawTx); err != nil {
-			log.Fatalf("local decode failed: %v", err)
-		}
+// Dial connects to config.RpcURL and builds a Client on top of that connection.
+func Dial(config *configs.Config, auth signer.Signer) (*Client, error) {
+	eth, err := ethclient.Dial(config.RpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", config.RpcURL, err)
+	}
+	return NewClient(config, eth, auth)
+}
 
-		txsHex = append(txsHex, hexutil.Encode(rawTx))
+// NewClient builds a Client around an existing Ethereum connection. auth signs every relay
+// request (X-Flashbots-Signature) and only serves as the searcher's reputation identity.
+func NewClient(config *configs.Config, eth *ethclient.Client, auth signer.Signer) (*Client, error) {
+	if eth == nil {
+		return nil, fmt.Errorf("nil ethereum client")
+	}
+	if auth == nil {
+		return nil, fmt.Errorf("nil flashbots signer")
 	}
 
+	c := &Client{
+		eth:        eth,
+		relayURL:   config.RelayURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		auth:       auth,
+	}
+	if c.relayURL == "" {
+		c.relayURL = configs.FLASHBOTS_RELAY_URL
+	}
+
+	relays, err := c.relaysFromConfig(config.Relays)
+	if err != nil {
+		return nil, err
+	}
+	c.relays = relays
+
+	return c, nil
+}
+
+// Eth returns the Ethereum connection the client was built with.
+func (c *Client) Eth() *ethclient.Client {
+	return c.eth
+}
+
+// Relays returns the relays bundles are fanned out to by SubmitBundleOverWindow.
+func (c *Client) Relays() []Relay {
+	return c.relays
+}
+
+// SimulateBundle runs the bundle through eth_callBundle on top of the latest block. If a transaction
+// fails that the bundle options do not allow to revert, the response is returned together with a
+// *SimulationRevertError describing it.
+func (c *Client) SimulateBundle(ctx context.Context, txs []*types.Transaction, opts ...BundleOption) (*SimulationResponse, error) {
 	// Get target block
-	client, _ := ethclient.Dial(configs.RPC_URL)
-	header, err := client.HeaderByNumber(ctx, nil)
+	header, err := c.eth.HeaderByNumber(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get latest block: %v", err)
 	}
-	targetBlock := header.Number.Uint64() + 1
 
-	// Prepare simulation request
+	bundle, err := NewBundle(txs, header.Number.Uint64()+1, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare simulation request. eth_callBundle has no reverting/dropping semantics, so only
+	// the timestamp bound is forwarded; callers check reverts against Bundle.CanRevert.
 	params := map[string]interface{}{
-		"txs":              txsHex,
-		"blockNumber":      fmt.Sprintf("0x%x", targetBlock),
+		"txs":              bundle.Txs,
+		"blockNumber":      bundle.BlockNumber,
 		"stateBlockNumber": "latest",
 	}
+	if bundle.MinTimestamp != 0 {
+		params["timestamp"] = bundle.MinTimestamp
+	}
 
 	request := Request{
 		Jsonrpc: "2.0",
@@ -60,80 +111,129 @@ func SimulateBundle(ctx context.Context, txs []*types.Transaction, authKey *ecds
 		Params:  []interface{}{params},
 	}
 
-	return SendFlashbotsRequest[SimulationResponse](ctx, request, authKey)
+	result, err := SendFlashbotsRequest[SimulationResponse](ctx, c, request)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, txResult := range result.Result.Results {
+		if txResult.Error != "" && !bundle.CanRevert(txResult.TxHash) {
+			return result, &SimulationRevertError{TxIndex: i, TxHash: txResult.TxHash, Reason: txResult.Error, Revert: txResult.Revert}
+		}
+	}
+	return result, nil
 }
 
-func SendBundle(ctx context.Context, txs []*types.Transaction, authKey *ecdsa.PrivateKey) (*SendResponse, error) {
-	// Encode transactions
+// encodeTransactions RLP-encodes txs and checks each one survives a local decode round-trip.
+func encodeTransactions(txs []*types.Transaction) ([]string, error) {
 	var txsHex []string
 	for i, tx := range txs {
 		rawTx, err := tx.MarshalBinary()
 		if err != nil {
-			return nil, fmt.Errorf("failed to encode transaction: %v", err)
+			return nil, &EncodingError{Index: i, Err: err}
 		}
-
 		log.Printf("TX %d len=%d firstByte=%#x", i+1, len(rawTx), rawTx[0])
 
-		txsHex = append(txsHex, hexutil.Encode(rawTx))
-
 		var chk types.Transaction
 		if err := chk.UnmarshalBinary(rawTx); err != nil {
-			log.Fatalf("local decode failed: %v", err)
+			return nil, &EncodingError{Index: i, Err: fmt.Errorf("local decode failed: %w", err)}
 		}
+
+		txsHex = append(txsHex, hexutil.Encode(rawTx))
 	}
+	return txsHex, nil
+}
 
-	// Get target block
-	client, _ := ethclient.Dial(configs.RPC_URL)
-	header, err := client.HeaderByNumber(ctx, nil)
+// NewBundle encodes txs into an eth_sendBundle payload targeting targetBlock.
+func NewBundle(txs []*types.Transaction, targetBlock uint64, opts ...BundleOption) (Bundle, error) {
+	txsHex, err := encodeTransactions(txs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get latest block: %v", err)
+		return Bundle{}, err
 	}
-	targetBlock := header.Number.Uint64() + 1
 
-	// Prepare send request
-	params := Bundle{
+	bundle := Bundle{
 		Txs:         txsHex,
 		BlockNumber: fmt.Sprintf("0x%x", targetBlock),
 	}
+	for _, opt := range opts {
+		opt(&bundle)
+	}
+	return bundle, nil
+}
 
+func sendBundleRequest(ctx context.Context, httpClient *http.Client, url string, bundle Bundle, auth signer.Signer) (*SendResponse, error) {
 	request := Request{
 		Jsonrpc: "2.0",
 		ID:      1,
 		Method:  "eth_sendBundle",
-		Params:  []interface{}{params},
+		Params:  []interface{}{bundle},
 	}
 
-	return SendFlashbotsRequest[SendResponse](ctx, request, authKey)
+	return sendSignedRequest[SendResponse](ctx, httpClient, url, request, auth)
 }
 
-func SendBundleWithRetries(ctx context.Context, txs []*types.Transaction, authKey *ecdsa.PrivateKey, maxRetries int) (*SendResponse, error) {
-	var lastErr error
+func cancelBundleRequest(ctx context.Context, httpClient *http.Client, url string, replacementUuid string, auth signer.Signer) (*CancelResponse, error) {
+	request := Request{
+		Jsonrpc: "2.0",
+		ID:      1,
+		Method:  "eth_cancelBundle",
+		Params: []interface{}{map[string]interface{}{
+			"replacementUuid": replacementUuid,
+		}},
+	}
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		result, err := SendBundle(ctx, txs, authKey)
-		if err == nil && result.Error == nil {
-			if attempt > 1 {
-				log.Printf("✅ Bundle sent successfully on attempt %d", attempt)
-			}
-			return result, nil
-		}
+	return sendSignedRequest[CancelResponse](ctx, httpClient, url, request, auth)
+}
 
-		if result != nil && result.Error != nil {
-			lastErr = fmt.Errorf("flashbots error: %s", result.Error.Message)
-		} else {
-			lastErr = err
-		}
+// NewReplacementUUID returns a random RFC 4122 version 4 UUID for Bundle.ReplacementUuid.
+func NewReplacementUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate replacement uuid: %v", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
 
-		if attempt < maxRetries {
-			log.Printf("🔄 Bundle send attempt %d failed, retrying: %v", attempt, lastErr)
-			time.Sleep(time.Duration(attempt) * time.Second)
-		}
+// GetBundleStats queries flashbots_getBundleStatsV2 for a bundle submitted to targetBlock.
+func (c *Client) GetBundleStats(ctx context.Context, bundleHash string, targetBlock uint64) (*BundleStatsResponse, error) {
+	request := Request{
+		Jsonrpc: "2.0",
+		ID:      1,
+		Method:  "flashbots_getBundleStatsV2",
+		Params: []interface{}{map[string]interface{}{
+			"bundleHash":  bundleHash,
+			"blockNumber": fmt.Sprintf("0x%x", targetBlock),
+		}},
+	}
+
+	return SendFlashbotsRequest[BundleStatsResponse](ctx, c, request)
+}
+
+// GetUserStats queries flashbots_getUserStatsV2 for the reputation of the signing key as of blockNumber.
+func (c *Client) GetUserStats(ctx context.Context, blockNumber uint64) (*UserStatsResponse, error) {
+	request := Request{
+		Jsonrpc: "2.0",
+		ID:      1,
+		Method:  "flashbots_getUserStatsV2",
+		Params: []interface{}{map[string]interface{}{
+			"blockNumber": fmt.Sprintf("0x%x", blockNumber),
+		}},
 	}
 
-	return nil, fmt.Errorf("failed to send bundle after %d attempts: %v", maxRetries, lastErr)
+	return SendFlashbotsRequest[UserStatsResponse](ctx, c, request)
+}
+
+// SendFlashbotsRequest posts a signed JSON-RPC request to the client's relay. It is a function
+// rather than a method because Go methods cannot take type parameters.
+func SendFlashbotsRequest[T any](ctx context.Context, c *Client, request Request) (*T, error) {
+	return sendSignedRequest[T](ctx, c.httpClient, c.relayURL, request, c.auth)
 }
 
-func SendFlashbotsRequest[T any](ctx context.Context, request Request, authKey *ecdsa.PrivateKey) (*T, error) {
+// sendSignedRequest posts a JSON-RPC request signed with the X-Flashbots-Signature scheme to url.
+// A JSON-RPC error object is returned as *RPCError, so the response types only carry results.
+func sendSignedRequest[T any](ctx context.Context, httpClient *http.Client, url string, request Request, auth signer.Signer) (*T, error) {
 	// Marshal request
 	reqBody, err := json.Marshal(request)
 	if err != nil {
@@ -141,13 +241,13 @@ func SendFlashbotsRequest[T any](ctx context.Context, request Request, authKey *
 	}
 
 	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", configs.FLASHBOTS_RELAY_URL, bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
 	}
 
 	// Sign request
-	signature, err := SignFlashbotsPayload(reqBody, authKey)
+	signature, err := SignFlashbotsPayload(ctx, reqBody, auth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign request: %v", err)
 	}
@@ -156,7 +256,6 @@ func SendFlashbotsRequest[T any](ctx context.Context, request Request, authKey *
 	httpReq.Header.Set("X-Flashbots-Signature", signature)
 
 	// Send request
-	httpClient := &http.Client{Timeout: 30 * time.Second}
 	resp, err := httpClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %v", err)
@@ -169,6 +268,20 @@ func SendFlashbotsRequest[T any](ctx context.Context, request Request, authKey *
 		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
+	// Relays report JSON-RPC errors both with 200 and with 4xx statuses
+	var envelope struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &envelope); err == nil && envelope.Error != nil {
+		return nil, &RPCError{Method: request.Method, Code: envelope.Error.Code, Message: envelope.Error.Message}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &HTTPStatusError{URL: url, StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
 	var result T
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
@@ -179,13 +292,14 @@ func SendFlashbotsRequest[T any](ctx context.Context, request Request, authKey *
 
 
 
-func SignFlashbotsPayload(body []byte, key *ecdsa.PrivateKey) (string, error) {
+// SignFlashbotsPayload returns the X-Flashbots-Signature header for body: the signer's address
+// and its EIP-191 signature of the hex-encoded keccak256 of body.
+func SignFlashbotsPayload(ctx context.Context, body []byte, auth signer.Signer) (string, error) {
 
 	rawHash := crypto.Keccak256(body)
 
 	hexHash := []byte(hexutil.Encode(rawHash))
-	prefixedHash := accounts.TextHash(hexHash)
-	sig, err := crypto.Sign(prefixedHash, key)
+	sig, err := auth.SignText(ctx, hexHash)
 	if err != nil {
 		return "", fmt.Errorf("sign error: %w", err)
 	}
@@ -193,7 +307,6 @@ func SignFlashbotsPayload(body []byte, key *ecdsa.PrivateKey) (string, error) {
 		sig[64] += 27
 	}
 
-	addr := crypto.PubkeyToAddress(key.PublicKey)
-	return fmt.Sprintf("%s:%s", addr.Hex(), hexutil.Encode(sig)), nil
+	return fmt.Sprintf("%s:%s", auth.Address().Hex(), hexutil.Encode(sig)), nil
 }
 
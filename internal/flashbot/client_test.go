@@ -0,0 +1,124 @@
+package flashbot_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/testchain"
+)
+
+// transferTx signs a test token transfer from the EOA, which holds no tokens and so reverts.
+func transferTx(t *testing.T, chain *testchain.Chain) *types.Transaction {
+	t.Helper()
+	header, err := chain.Client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("failed to get latest block: %v", err)
+	}
+	data := append(crypto.Keccak256([]byte("transfer(address,uint256)"))[:4], common.LeftPadBytes(chain.EOA().Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(params.Ether).Bytes(), 32)...)
+
+	tx, err := types.SignNewTx(chain.EOAKey, types.LatestSignerForChainID(chain.ChainID), &types.DynamicFeeTx{
+		ChainID:   chain.ChainID,
+		GasTipCap: big.NewInt(params.GWei),
+		GasFeeCap: new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), big.NewInt(params.GWei)),
+		Gas:       100000,
+		To:        &testchain.TokenAddress,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+func TestSimulateBundleReportsReverts(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	fb, err := flashbot.NewClient(chain.Config(relay.URL, big.NewInt(params.Ether)), chain.Client, chain.FlashbotsSigner())
+	if err != nil {
+		t.Fatalf("failed to create flashbots client: %v", err)
+	}
+	tx := transferTx(t, chain)
+
+	_, err = fb.SimulateBundle(context.Background(), []*types.Transaction{tx})
+	var revertErr *flashbot.SimulationRevertError
+	if !errors.As(err, &revertErr) {
+		t.Fatalf("expected a SimulationRevertError, got %v", err)
+	}
+	if revertErr.TxIndex != 0 {
+		t.Errorf("expected the revert at transaction 0, got %d", revertErr.TxIndex)
+	}
+
+	sim, err := fb.SimulateBundle(context.Background(), []*types.Transaction{tx}, flashbot.WithRevertingTxHashes(tx.Hash()))
+	if err != nil {
+		t.Fatalf("expected a revertible transaction to be accepted, got %v", err)
+	}
+	if sim.Result.Results[0].Error == "" {
+		t.Error("expected the revert to be reported in the results")
+	}
+}
+
+func TestRelayRejectsRequestsSignedByAnotherKey(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	fb, err := flashbot.NewClient(chain.Config(relay.URL, big.NewInt(params.Ether)), chain.Client, chain.FlashbotsSigner())
+	if err != nil {
+		t.Fatalf("failed to create flashbots client: %v", err)
+	}
+
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"flashbots_getUserStatsV2","params":[]}`)
+	signature, err := flashbot.SignFlashbotsPayload(context.Background(), body, chain.EOASigner())
+	if err != nil {
+		t.Fatalf("failed to sign payload: %v", err)
+	}
+	forged := crypto.PubkeyToAddress(chain.FlashbotsKey.PublicKey).Hex() + signature[len(common.Address{}.Hex()):]
+	req, err := http.NewRequest(http.MethodPost, relay.URL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("X-Flashbots-Signature", forged)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to reach relay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a forged signature to be rejected with 403, got %d", resp.StatusCode)
+	}
+
+	if _, err := fb.GetUserStats(context.Background(), 1); err != nil {
+		t.Errorf("relay rejected a correctly signed request: %v", err)
+	}
+}
+
+func TestRelayErrorsAreTyped(t *testing.T) {
+	chain := testchain.New(t)
+	relay := testchain.NewRelay(t, chain)
+	fb, err := flashbot.NewClient(chain.Config(relay.URL, big.NewInt(params.Ether)), chain.Client, chain.FlashbotsSigner())
+	if err != nil {
+		t.Fatalf("failed to create flashbots client: %v", err)
+	}
+
+	request := flashbot.Request{Jsonrpc: "2.0", ID: 1, Method: "eth_sendBundle", Params: []interface{}{"not a bundle"}}
+	resp, err := flashbot.SendFlashbotsRequest[flashbot.SendResponse](context.Background(), fb, request)
+	var rpcErr *flashbot.RPCError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("expected an RPCError, got response %+v and error %v", resp, err)
+	}
+	if rpcErr.Method != "eth_sendBundle" || rpcErr.Code != -32000 {
+		t.Errorf("unexpected relay error %+v", rpcErr)
+	}
+	if flashbot.IsRetryable(err) {
+		t.Error("expected a JSON-RPC error not to be retried")
+	}
+}
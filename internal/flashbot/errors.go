@@ -0,0 +1,78 @@
+package flashbot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// RPCError is a JSON-RPC error object returned by a relay.
+type RPCError struct {
+	Method  string
+	Code    int
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s: relay error %d: %s", e.Method, e.Code, e.Message)
+}
+
+// HTTPStatusError is a non-2xx relay response without a JSON-RPC error body.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("relay %s returned HTTP %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// EncodingError means a transaction could not be encoded or did not survive a local decode
+// round-trip. Index is the position of the transaction in the bundle.
+type EncodingError struct {
+	Index int
+	Err   error
+}
+
+func (e *EncodingError) Error() string {
+	return fmt.Sprintf("transaction %d encoding failed: %v", e.Index+1, e.Err)
+}
+
+func (e *EncodingError) Unwrap() error {
+	return e.Err
+}
+
+// SimulationRevertError reports the first bundle transaction that failed in eth_callBundle and
+// is not listed in revertingTxHashes.
+type SimulationRevertError struct {
+	TxIndex int
+	TxHash  string
+	Reason  string
+	Revert  string
+}
+
+func (e *SimulationRevertError) Error() string {
+	return fmt.Sprintf("transaction %d (%s) simulation error: %s - %s", e.TxIndex+1, e.TxHash, e.Reason, e.Revert)
+}
+
+// IsRetryable reports whether err is worth retrying unchanged: transport failures, rate limits
+// and relay-side 5xx. Encoding errors, simulation reverts and JSON-RPC errors are permanent.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var encErr *EncodingError
+	var revertErr *SimulationRevertError
+	var rpcErr *RPCError
+	var statusErr *HTTPStatusError
+	switch {
+	case errors.As(err, &encErr), errors.As(err, &revertErr), errors.As(err, &rpcErr):
+		return false
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	default:
+		return true
+	}
+}
@@ -0,0 +1,78 @@
+package flashbot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MevShareParams describes how a bundle is shared with searchers through MEV-Share.
+type MevShareParams struct {
+	Block    uint64 // first block the bundle is valid for
+	MaxBlock uint64 // last block the bundle is valid for; 0 means Block only
+	// RefundTxIndex is the body index whose backrun value is refunded, RefundPercent the share
+	// of it paid back to the sender (0-100).
+	RefundTxIndex int
+	RefundPercent int
+	// RefundAddress optionally redirects the refund; zero means the tx signer.
+	RefundAddress common.Address
+	Hints         []string
+	Builders      []string
+	// CanRevert marks body indexes allowed to revert without invalidating the bundle.
+	CanRevert map[int]bool
+}
+
+// NewMevShareBundle encodes txs into a mev_sendBundle payload with refund and privacy hints.
+func NewMevShareBundle(txs []*types.Transaction, params MevShareParams) (MevShareBundle, error) {
+	bundle := MevShareBundle{
+		Version:   "v0.1",
+		Inclusion: MevShareInclusion{Block: fmt.Sprintf("0x%x", params.Block)},
+	}
+	if params.MaxBlock > params.Block {
+		bundle.Inclusion.MaxBlock = fmt.Sprintf("0x%x", params.MaxBlock)
+	}
+
+	for i, tx := range txs {
+		rawTx, err := tx.MarshalBinary()
+		if err != nil {
+			return MevShareBundle{}, fmt.Errorf("failed to encode transaction: %v", err)
+		}
+		bundle.Body = append(bundle.Body, MevShareBodyItem{
+			Tx:        hexutil.Encode(rawTx),
+			CanRevert: params.CanRevert[i],
+		})
+	}
+
+	if params.RefundPercent > 0 {
+		if params.RefundPercent > 100 || params.RefundTxIndex < 0 || params.RefundTxIndex >= len(txs) {
+			return MevShareBundle{}, fmt.Errorf("invalid refund: %d%% of body index %d", params.RefundPercent, params.RefundTxIndex)
+		}
+		bundle.Validity = &MevShareValidity{
+			Refund: []MevShareRefund{{BodyIdx: params.RefundTxIndex, Percent: params.RefundPercent}},
+		}
+		if params.RefundAddress != (common.Address{}) {
+			bundle.Validity.RefundConfig = []MevShareRefundConfig{{Address: params.RefundAddress.Hex(), Percent: 100}}
+		}
+	}
+
+	if len(params.Hints) > 0 || len(params.Builders) > 0 {
+		bundle.Privacy = &MevSharePrivacy{Hints: params.Hints, Builders: params.Builders}
+	}
+
+	return bundle, nil
+}
+
+// SendMevShareBundle submits the bundle through mev_sendBundle.
+func (c *Client) SendMevShareBundle(ctx context.Context, bundle MevShareBundle) (*SendResponse, error) {
+	request := Request{
+		Jsonrpc: "2.0",
+		ID:      1,
+		Method:  "mev_sendBundle",
+		Params:  []interface{}{bundle},
+	}
+
+	return SendFlashbotsRequest[SendResponse](ctx, c, request)
+}
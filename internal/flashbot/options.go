@@ -0,0 +1,60 @@
+package flashbot
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BundleOption sets an optional eth_sendBundle field on a Bundle.
+type BundleOption func(*Bundle)
+
+// WithMinTimestamp makes the bundle valid only in blocks with a timestamp at or after ts.
+func WithMinTimestamp(ts uint64) BundleOption {
+	return func(b *Bundle) {
+		b.MinTimestamp = ts
+	}
+}
+
+// WithMaxTimestamp makes the bundle valid only in blocks with a timestamp at or before ts.
+func WithMaxTimestamp(ts uint64) BundleOption {
+	return func(b *Bundle) {
+		b.MaxTimestamp = ts
+	}
+}
+
+// WithRevertingTxHashes lets the given transactions revert without invalidating the bundle.
+func WithRevertingTxHashes(hashes ...common.Hash) BundleOption {
+	return func(b *Bundle) {
+		for _, hash := range hashes {
+			b.RevertingTxHashes = append(b.RevertingTxHashes, hash.Hex())
+		}
+	}
+}
+
+// WithDroppingTxHashes lets builders drop the given transactions (e.g. when their nonce is
+// already used) and still include the rest of the bundle.
+func WithDroppingTxHashes(hashes ...common.Hash) BundleOption {
+	return func(b *Bundle) {
+		for _, hash := range hashes {
+			b.DroppingTxHashes = append(b.DroppingTxHashes, hash.Hex())
+		}
+	}
+}
+
+// WithReplacementUuid tags the bundle so it can later be replaced or cancelled.
+func WithReplacementUuid(uuid string) BundleOption {
+	return func(b *Bundle) {
+		b.ReplacementUuid = uuid
+	}
+}
+
+// CanRevert reports whether txHash is listed in the bundle's revertingTxHashes.
+func (b Bundle) CanRevert(txHash string) bool {
+	for _, hash := range b.RevertingTxHashes {
+		if strings.EqualFold(hash, txHash) {
+			return true
+		}
+	}
+	return false
+}
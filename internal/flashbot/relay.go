@@ -0,0 +1,149 @@
+package flashbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
+)
+
+// Relay is a bundle endpoint speaking the eth_sendBundle dialect (a relay or a block builder).
+type Relay interface {
+	Name() string
+	SendBundle(ctx context.Context, bundle Bundle, auth signer.Signer) (*SendResponse, error)
+	CancelBundle(ctx context.Context, replacementUuid string, auth signer.Signer) (*CancelResponse, error)
+}
+
+// HTTPRelay posts signed JSON-RPC bundles to a single endpoint.
+type HTTPRelay struct {
+	name       string
+	url        string
+	httpClient *http.Client
+}
+
+func NewHTTPRelay(name, url string, httpClient *http.Client) *HTTPRelay {
+	return &HTTPRelay{name: name, url: url, httpClient: httpClient}
+}
+
+func (r *HTTPRelay) Name() string {
+	return r.name
+}
+
+func (r *HTTPRelay) SendBundle(ctx context.Context, bundle Bundle, auth signer.Signer) (*SendResponse, error) {
+	return sendBundleRequest(ctx, r.httpClient, r.url, bundle, auth)
+}
+
+func (r *HTTPRelay) CancelBundle(ctx context.Context, replacementUuid string, auth signer.Signer) (*CancelResponse, error) {
+	return cancelBundleRequest(ctx, r.httpClient, r.url, replacementUuid, auth)
+}
+
+// relaysFromConfig resolves relay names from configs.KnownRelays; entries starting with http are
+// used as raw endpoint URLs and "flashbots" follows the client's configured relay URL.
+func (c *Client) relaysFromConfig(names []string) ([]Relay, error) {
+	var relays []Relay
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+			relays = append(relays, NewHTTPRelay(name, name, c.httpClient))
+			continue
+		}
+		name = strings.ToLower(name)
+		url, ok := configs.KnownRelays[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown relay %q", name)
+		}
+		if name == "flashbots" {
+			url = c.relayURL
+		}
+		relays = append(relays, NewHTTPRelay(name, url, c.httpClient))
+	}
+	if len(relays) == 0 {
+		relays = append(relays, NewHTTPRelay("flashbots", c.relayURL, c.httpClient))
+	}
+	return relays, nil
+}
+
+// RelayResult records how a single relay answered a bundle submission.
+type RelayResult struct {
+	Relay      string
+	BundleHash string
+	Err        error
+}
+
+func (r RelayResult) Accepted() bool {
+	return r.Err == nil
+}
+
+// MultiRelaySubmitter sends the same signed bundle to several relays in parallel.
+type MultiRelaySubmitter struct {
+	Relays []Relay
+}
+
+func NewMultiRelaySubmitter(relays ...Relay) *MultiRelaySubmitter {
+	return &MultiRelaySubmitter{Relays: relays}
+}
+
+// SendBundle fans the bundle out to every relay and returns one result per relay, in relay order.
+func (m *MultiRelaySubmitter) SendBundle(ctx context.Context, bundle Bundle, auth signer.Signer) []RelayResult {
+	results := make([]RelayResult, len(m.Relays))
+
+	var wg sync.WaitGroup
+	for i, relay := range m.Relays {
+		wg.Add(1)
+		go func(i int, relay Relay) {
+			defer wg.Done()
+
+			result := RelayResult{Relay: relay.Name()}
+			resp, err := relay.SendBundle(ctx, bundle, auth)
+			if err != nil {
+				result.Err = err
+			} else {
+				result.BundleHash = resp.Result.BundleHash
+			}
+			results[i] = result
+		}(i, relay)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Accepted() {
+			log.Printf("   ✅ %s accepted bundle %s", result.Relay, result.BundleHash)
+		} else {
+			log.Printf("   ❌ %s rejected bundle: %v", result.Relay, result.Err)
+		}
+	}
+	return results
+}
+
+// CancelBundle asks every relay to drop the bundles submitted under replacementUuid.
+func (m *MultiRelaySubmitter) CancelBundle(ctx context.Context, replacementUuid string, auth signer.Signer) []RelayResult {
+	results := make([]RelayResult, len(m.Relays))
+
+	var wg sync.WaitGroup
+	for i, relay := range m.Relays {
+		wg.Add(1)
+		go func(i int, relay Relay) {
+			defer wg.Done()
+
+			result := RelayResult{Relay: relay.Name()}
+			_, result.Err = relay.CancelBundle(ctx, replacementUuid, auth)
+			results[i] = result
+		}(i, relay)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if !result.Accepted() {
+			log.Printf("   ⚠️  %s failed to cancel bundle %s: %v", result.Relay, replacementUuid, result.Err)
+		}
+	}
+	return results
+}
@@ -0,0 +1,228 @@
+package flashbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// SubmitOptions controls how a bundle is resubmitted across consecutive blocks.
+type SubmitOptions struct {
+	// BlockWindow is the number of consecutive blocks, starting at latest+1, the bundle is targeted at.
+	BlockWindow uint64
+	// Deadline is the on-chain deadline of the bundled transactions; submission stops once a block reaches it.
+	Deadline time.Time
+	// Rebuild re-signs the bundle with fresh gas parameters. It is called when the next block's
+	// base fee can exceed the fee cap of the current transactions. Nil disables repricing.
+	Rebuild func(ctx context.Context) ([]*types.Transaction, error)
+	// Requote is called on every new head after the first submission. It returns a rebuilt bundle
+	// when the quote behind the current one is stale, or nil to keep it. A stale bundle is
+	// cancelled through its replacementUuid before the new one is sent.
+	Requote func(ctx context.Context, header *types.Header) ([]*types.Transaction, error)
+	// BundleOptions returns the optional bundle fields for a given set of transactions. It is
+	// re-evaluated whenever the bundle is rebuilt, since tx hashes change on re-signing.
+	BundleOptions func(txs []*types.Transaction) []BundleOption
+	// PollInterval is used when the RPC endpoint does not support head subscriptions.
+	PollInterval time.Duration
+	// Relays receive every submission in parallel. Empty means the client's configured relays.
+	Relays []Relay
+}
+
+type SubmitResult struct {
+	Txs             []*types.Transaction // the transactions of the last submitted bundle
+	BundleHashes    map[uint64]string    // relay bundle hash per target block
+	RelayResults    map[uint64][]RelayResult
+	ReplacementUuid string // replacementUuid of the last submitted bundle
+	Replacements    int
+	IncludedBlock   uint64
+}
+
+// WatchNewHeads streams new block headers, subscribing when the endpoint supports it and
+// falling back to polling otherwise. The returned function stops the watcher.
+func (c *Client) WatchNewHeads(ctx context.Context, pollInterval time.Duration) (<-chan *types.Header, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	heads := make(chan *types.Header, 16)
+
+	sub, err := c.eth.SubscribeNewHead(ctx, heads)
+	if err == nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case err, ok := <-sub.Err():
+				if !ok {
+					// closed by Unsubscribe
+					return
+				}
+				log.Printf("⚠️  Head subscription dropped, falling back to polling: %v", err)
+				pollHeads(ctx, c.eth, pollInterval, heads)
+			}
+		}()
+		return heads, func() {
+			sub.Unsubscribe()
+			cancel()
+		}
+	}
+
+	log.Printf("ℹ️  Head subscription unavailable (%v), polling every %v", err, pollInterval)
+	go pollHeads(ctx, c.eth, pollInterval, heads)
+	return heads, cancel
+}
+
+func pollHeads(ctx context.Context, client *ethclient.Client, interval time.Duration, heads chan<- *types.Header) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			header, err := client.HeaderByNumber(ctx, nil)
+			if err != nil || header.Number.Uint64() <= last {
+				continue
+			}
+			last = header.Number.Uint64()
+			select {
+			case heads <- header:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// SubmitBundleOverWindow targets the bundle at each of the next opts.BlockWindow blocks, resubmitting
+// on every new head until the bundle lands, the window is exhausted or the deadline passes.
+func (c *Client) SubmitBundleOverWindow(ctx context.Context, txs []*types.Transaction, opts SubmitOptions) (*SubmitResult, error) {
+	if len(txs) == 0 {
+		return nil, fmt.Errorf("empty bundle")
+	}
+	if opts.BlockWindow == 0 {
+		opts.BlockWindow = 1
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = time.Second
+	}
+
+	heads, stop := c.WatchNewHeads(ctx, opts.PollInterval)
+	defer stop()
+
+	header, err := c.eth.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %v", err)
+	}
+
+	relays := opts.Relays
+	if len(relays) == 0 {
+		relays = c.relays
+	}
+	submitter := NewMultiRelaySubmitter(relays...)
+
+	result := &SubmitResult{Txs: txs, BundleHashes: make(map[uint64]string), RelayResults: make(map[uint64][]RelayResult)}
+	if result.ReplacementUuid, err = NewReplacementUUID(); err != nil {
+		return nil, err
+	}
+	firstHead := header.Number.Uint64()
+	lastTarget := firstHead + opts.BlockWindow
+	lastSeen := uint64(0)
+
+	for {
+		if number := header.Number.Uint64(); number > lastSeen {
+			lastSeen = number
+
+			if block, landed := c.bundleIncluded(ctx, result.Txs); landed {
+				result.IncludedBlock = block
+				log.Printf("🎉 Bundle landed in block %d", block)
+				return result, nil
+			}
+			if !opts.Deadline.IsZero() && header.Time >= uint64(opts.Deadline.Unix()) {
+				return result, fmt.Errorf("transaction deadline passed at block %d before the bundle landed", number)
+			}
+
+			target := number + 1
+			if target > lastTarget {
+				return result, fmt.Errorf("bundle not included within %d blocks (last target %d)", opts.BlockWindow, lastTarget)
+			}
+
+			if opts.Requote != nil && number > firstHead {
+				requoted, err := opts.Requote(ctx, header)
+				if err != nil {
+					return result, fmt.Errorf("failed to requote bundle: %v", err)
+				}
+				if requoted != nil {
+					log.Printf("♻️  Quote changed at block %d, cancelling bundle %s", number, result.ReplacementUuid)
+					submitter.CancelBundle(ctx, result.ReplacementUuid, c.auth)
+					if result.ReplacementUuid, err = NewReplacementUUID(); err != nil {
+						return result, err
+					}
+					result.Txs = requoted
+					result.Replacements++
+				}
+			}
+
+			if opts.Rebuild != nil && needsRepricing(header, result.Txs) {
+				log.Printf("⛽ Base fee %s wei may exceed the bundle fee cap, re-signing with fresh gas parameters", header.BaseFee)
+				rebuilt, err := opts.Rebuild(ctx)
+				if err != nil {
+					return result, fmt.Errorf("failed to rebuild bundle: %v", err)
+				}
+				result.Txs = rebuilt
+			}
+
+			var bundleOpts []BundleOption
+			if opts.BundleOptions != nil {
+				bundleOpts = opts.BundleOptions(result.Txs)
+			}
+			bundle, err := NewBundle(result.Txs, target, append(bundleOpts, WithReplacementUuid(result.ReplacementUuid))...)
+			if err != nil {
+				return result, err
+			}
+
+			log.Printf("📤 Submitting bundle for block %d (%d/%d) to %d relay(s)", target, target+opts.BlockWindow-lastTarget, opts.BlockWindow, len(relays))
+			results := submitter.SendBundle(ctx, bundle, c.auth)
+			result.RelayResults[target] = results
+			for _, r := range results {
+				if r.Accepted() {
+					result.BundleHashes[target] = r.BundleHash
+					break
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case next := <-heads:
+			header = next
+		}
+	}
+}
+
+// needsRepricing reports whether the base fee of the block after header can exceed the fee cap
+// of any dynamic-fee transaction in the bundle. The base fee rises by at most 1/8 per block.
+func needsRepricing(header *types.Header, txs []*types.Transaction) bool {
+	if header.BaseFee == nil {
+		return false
+	}
+	maxNextBaseFee := new(big.Int).Add(header.BaseFee, new(big.Int).Div(header.BaseFee, big.NewInt(8)))
+	for _, tx := range txs {
+		if tx.Type() == types.DynamicFeeTxType && tx.GasFeeCap().Cmp(maxNextBaseFee) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) bundleIncluded(ctx context.Context, txs []*types.Transaction) (uint64, bool) {
+	receipt, err := c.eth.TransactionReceipt(ctx, txs[len(txs)-1].Hash())
+	if err != nil || receipt == nil {
+		return 0, false
+	}
+	return receipt.BlockNumber.Uint64(), true
+}
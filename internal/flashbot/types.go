@@ -1,8 +1,13 @@
 package flashbot
 
 type Bundle struct {
-	Txs         []string `json:"txs"`
-	BlockNumber string   `json:"blockNumber"`
+	Txs               []string `json:"txs"`
+	BlockNumber       string   `json:"blockNumber"`
+	MinTimestamp      uint64   `json:"minTimestamp,omitempty"`
+	MaxTimestamp      uint64   `json:"maxTimestamp,omitempty"`
+	RevertingTxHashes []string `json:"revertingTxHashes,omitempty"`
+	DroppingTxHashes  []string `json:"droppingTxHashes,omitempty"`
+	ReplacementUuid   string   `json:"replacementUuid,omitempty"`
 }
 
 type Request struct {
@@ -37,10 +42,6 @@ type SimulationResponse struct {
 		StateBlockNumber int64 `json:"stateBlockNumber"`
 		TotalGasUsed     int64 `json:"totalGasUsed"`
 	} `json:"result"`
-	Error *struct {
-		Code    int    `json:"code"`
-		Message string `json:"message"`
-	} `json:"error,omitempty"`
 }
 
 type SendResponse struct {
@@ -49,8 +50,82 @@ type SendResponse struct {
 	Result  struct {
 		BundleHash string `json:"bundleHash"`
 	} `json:"result"`
-	Error *struct {
-		Code    int    `json:"code"`
-		Message string `json:"message"`
-	} `json:"error,omitempty"`
-}
\ No newline at end of file
+}
+
+type CancelResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Result  interface{} `json:"result"`
+}
+
+type BuilderTimestamp struct {
+	Pubkey    string `json:"pubkey"`
+	Timestamp string `json:"timestamp"`
+}
+
+type BundleStatsResponse struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		IsHighPriority         bool               `json:"isHighPriority"`
+		IsSimulated            bool               `json:"isSimulated"`
+		SimulatedAt            string             `json:"simulatedAt"`
+		ReceivedAt             string             `json:"receivedAt"`
+		ConsideredByBuildersAt []BuilderTimestamp `json:"consideredByBuildersAt"`
+		SealedByBuildersAt     []BuilderTimestamp `json:"sealedByBuildersAt"`
+	} `json:"result"`
+}
+
+type UserStatsResponse struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		IsHighPriority           bool   `json:"isHighPriority"`
+		AllTimeValidatorPayments string `json:"allTimeValidatorPayments"`
+		AllTimeGasSimulated      string `json:"allTimeGasSimulated"`
+		Last7dValidatorPayments  string `json:"last7dValidatorPayments"`
+		Last7dGasSimulated       string `json:"last7dGasSimulated"`
+		Last1dValidatorPayments  string `json:"last1dValidatorPayments"`
+		Last1dGasSimulated       string `json:"last1dGasSimulated"`
+	} `json:"result"`
+}
+
+// MEV-Share mev_sendBundle payload
+type MevShareBundle struct {
+	Version   string             `json:"version"`
+	Inclusion MevShareInclusion  `json:"inclusion"`
+	Body      []MevShareBodyItem `json:"body"`
+	Validity  *MevShareValidity  `json:"validity,omitempty"`
+	Privacy   *MevSharePrivacy   `json:"privacy,omitempty"`
+}
+
+type MevShareInclusion struct {
+	Block    string `json:"block"`
+	MaxBlock string `json:"maxBlock,omitempty"`
+}
+
+type MevShareBodyItem struct {
+	Tx        string `json:"tx,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	CanRevert bool   `json:"canRevert"`
+}
+
+type MevShareValidity struct {
+	Refund       []MevShareRefund       `json:"refund,omitempty"`
+	RefundConfig []MevShareRefundConfig `json:"refundConfig,omitempty"`
+}
+
+type MevShareRefund struct {
+	BodyIdx int `json:"bodyIdx"`
+	Percent int `json:"percent"`
+}
+
+type MevShareRefundConfig struct {
+	Address string `json:"address"`
+	Percent int    `json:"percent"`
+}
+
+type MevSharePrivacy struct {
+	Hints    []string `json:"hints,omitempty"`
+	Builders []string `json:"builders,omitempty"`
+}
@@ -0,0 +1,99 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// ForEOA returns the signer of the trading account: the keystore in config.EoaKeystore, the raw
+// config.EoaPrivateKey, or else config.EoaAddress on config.ExternalSigner.
+func ForEOA(ctx context.Context, config *configs.Config) (Signer, error) {
+	switch {
+	case config.EoaKeystore != "":
+		return OpenKeystore(config.EoaKeystore, config.EoaPasswordFile)
+	case config.EoaPrivateKey != "":
+		return rawKey("EOA", config.EoaPrivateKey)
+	case config.ExternalSigner != "":
+		return DialExternal(ctx, config.ExternalSigner, config.EoaAddress)
+	}
+	return nil, fmt.Errorf("no EOA signer configured: set eoa-keystore or external-signer (or eoa-key for development)")
+}
+
+// ForFlashbots returns the signer of relay requests: the keystore in config.FlashbotsKeystore,
+// config.FlashbotsAddress on config.ExternalSigner, the raw config.FlashbotsSignerKey, or else
+// the reputation key at ReputationKeystorePath, created on first run. The key only carries the
+// searcher's relay reputation, so it must not be eoa, the trading account.
+func ForFlashbots(ctx context.Context, config *configs.Config, eoa common.Address) (Signer, error) {
+	return flashbotsSigner(ctx, config, eoa, openReputationKey)
+}
+
+// OpenFlashbots is ForFlashbots for commands that only inspect the key: the reputation key must
+// already exist and is never created.
+func OpenFlashbots(ctx context.Context, config *configs.Config, eoa common.Address) (Signer, error) {
+	return flashbotsSigner(ctx, config, eoa, openExistingReputationKey)
+}
+
+func flashbotsSigner(ctx context.Context, config *configs.Config, eoa common.Address, reputationKey func(*configs.Config) (*KeySigner, error)) (Signer, error) {
+	var s Signer
+	var err error
+	switch {
+	case config.FlashbotsKeystore != "":
+		s, err = OpenKeystore(config.FlashbotsKeystore, config.FlashbotsPasswordFile)
+	case config.FlashbotsAddress != (common.Address{}):
+		s, err = DialExternal(ctx, config.ExternalSigner, config.FlashbotsAddress)
+	case config.FlashbotsSignerKey != "":
+		s, err = rawKey("Flashbots", config.FlashbotsSignerKey)
+	default:
+		s, err = reputationKey(config)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Address() == eoa {
+		return nil, fmt.Errorf("the Flashbots signer %s is the trading account; relay requests need a separate reputation key", eoa.Hex())
+	}
+	return s, nil
+}
+
+// EOAAddress resolves the trading account of config without unlocking it: the address recorded
+// in config.EoaKeystore, the address of config.EoaPrivateKey, or the account ForEOA would pick on
+// config.ExternalSigner.
+func EOAAddress(ctx context.Context, config *configs.Config) (common.Address, error) {
+	switch {
+	case config.EoaKeystore != "":
+		return KeystoreAddress(config.EoaKeystore)
+	case config.EoaPrivateKey != "":
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(config.EoaPrivateKey, "0x"))
+		if err != nil {
+			return common.Address{}, fmt.Errorf("invalid EOA private key: %v", err)
+		}
+		return crypto.PubkeyToAddress(key.PublicKey), nil
+	case config.ExternalSigner != "":
+		s, err := DialExternal(ctx, config.ExternalSigner, config.EoaAddress)
+		if err != nil {
+			return common.Address{}, err
+		}
+		defer s.Close()
+		return s.Address(), nil
+	}
+	return common.Address{}, fmt.Errorf("no EOA signer configured: set eoa-keystore or external-signer (or eoa-key for development)")
+}
+
+// rawKey parses a hex private key. Plaintext keys end up in shell history and process listings,
+// so they are only meant for development.
+func rawKey(name, hexKey string) (*KeySigner, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s private key: %v", name, err)
+	}
+	log.Printf("⚠️  Using a plaintext %s private key; use a keystore or an external signer outside development", name)
+	return NewKeySigner(key), nil
+}
@@ -0,0 +1,145 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// ExternalSigner forwards every signature request to a clef-compatible signer over JSON-RPC.
+// The key never enters the process, and the signer's operator or rules approve each request.
+type ExternalSigner struct {
+	client  *rpc.Client
+	address common.Address
+}
+
+// DialExternal connects to the signer at endpoint, an IPC path or an HTTP URL, see NewExternal.
+func DialExternal(ctx context.Context, endpoint string, address common.Address) (*ExternalSigner, error) {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to external signer %s: %v", endpoint, err)
+	}
+	s, err := NewExternal(ctx, client, address)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewExternal signs for address through client, or for the signer's only account when address
+// is the zero address.
+func NewExternal(ctx context.Context, client *rpc.Client, address common.Address) (*ExternalSigner, error) {
+	var listed []common.Address
+	if err := client.CallContext(ctx, &listed, "account_list"); err != nil {
+		return nil, fmt.Errorf("failed to list external signer accounts: %v", err)
+	}
+
+	if address == (common.Address{}) {
+		if len(listed) != 1 {
+			return nil, fmt.Errorf("external signer has %d accounts, select one by address", len(listed))
+		}
+		address = listed[0]
+	}
+	for _, account := range listed {
+		if account == address {
+			return &ExternalSigner{client: client, address: address}, nil
+		}
+	}
+	return nil, fmt.Errorf("external signer does not manage %s", address.Hex())
+}
+
+func (s *ExternalSigner) Address() common.Address {
+	return s.address
+}
+
+// signTransactionResult is the account_signTransaction response.
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func (s *ExternalSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	data := hexutil.Bytes(tx.Data())
+	args := apitypes.SendTxArgs{
+		From:    common.NewMixedcaseAddress(s.address),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Input:   &data,
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+	switch tx.Type() {
+	case types.LegacyTxType:
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	case types.DynamicFeeTxType:
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+		accessList := tx.AccessList()
+		args.AccessList = &accessList
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %d", tx.Type())
+	}
+
+	var result signTransactionResult
+	if err := s.client.CallContext(ctx, &result, "account_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("external signer refused transaction: %v", err)
+	}
+	if result.Tx == nil {
+		return nil, fmt.Errorf("external signer returned no transaction")
+	}
+	// The signer may have edited the transaction; it must still come from the same account
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), result.Tx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature from external signer: %v", err)
+	}
+	if sender != s.address {
+		return nil, fmt.Errorf("external signer signed as %s instead of %s", sender.Hex(), s.address.Hex())
+	}
+	return result.Tx, nil
+}
+
+func (s *ExternalSigner) SignText(ctx context.Context, text []byte) ([]byte, error) {
+	var signature hexutil.Bytes
+	address := common.NewMixedcaseAddress(s.address)
+	if err := s.client.CallContext(ctx, &signature, "account_signData", accounts.MimetypeTextPlain, &address, hexutil.Encode(text)); err != nil {
+		return nil, fmt.Errorf("external signer refused message: %v", err)
+	}
+	return normalizeV(signature)
+}
+
+func (s *ExternalSigner) SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error) {
+	var signature hexutil.Bytes
+	address := common.NewMixedcaseAddress(s.address)
+	if err := s.client.CallContext(ctx, &signature, "account_signTypedData", &address, data); err != nil {
+		return nil, fmt.Errorf("external signer refused typed data: %v", err)
+	}
+	return normalizeV(signature)
+}
+
+// Close disconnects from the signer.
+func (s *ExternalSigner) Close() {
+	s.client.Close()
+}
+
+// normalizeV converts clef's 27/28 recovery id to the 0/1 of crypto.Sign.
+func normalizeV(signature []byte) ([]byte, error) {
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("invalid signature length %d from external signer", len(signature))
+	}
+	if signature[64] >= 27 {
+		signature[64] -= 27
+	}
+	return signature, nil
+}
@@ -0,0 +1,70 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/term"
+)
+
+// OpenKeystore decrypts the go-ethereum keystore file at path. The password is read from
+// passwordFile, or prompted for on the terminal when passwordFile is empty.
+func OpenKeystore(path, passwordFile string) (*KeySigner, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %v", err)
+	}
+	password, err := ReadPassword(passwordFile, "Password for "+path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(keyJSON, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore %s: %v", path, err)
+	}
+	return NewKeySigner(key.PrivateKey), nil
+}
+
+// KeystoreAddress returns the address recorded in the keystore file at path without decrypting it.
+func KeystoreAddress(path string) (common.Address, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to read keystore: %v", err)
+	}
+	var header struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(keyJSON, &header); err != nil || !common.IsHexAddress(header.Address) {
+		return common.Address{}, fmt.Errorf("keystore %s records no valid address", path)
+	}
+	return common.HexToAddress(header.Address), nil
+}
+
+// ReadPassword returns the first line of passwordFile, or prompts for a password on the
+// terminal without echoing it when passwordFile is empty.
+func ReadPassword(passwordFile, prompt string) (string, error) {
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %v", err)
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no password file given and stdin is not a terminal")
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+	return string(password), nil
+}
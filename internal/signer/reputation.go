@@ -0,0 +1,121 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"golang.org/x/term"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+// Scrypt cost of newly created keystores; lowered by tests.
+var scryptN, scryptP = keystore.StandardScryptN, keystore.StandardScryptP
+
+// ReputationKeystorePath is where the Flashbots reputation key of config lives when no other
+// Flashbots signer is configured: next to the config file, or in the working directory.
+func ReputationKeystorePath(config *configs.Config) string {
+	dir := "."
+	if config.ConfigFile != "" {
+		dir = filepath.Dir(config.ConfigFile)
+	}
+	return filepath.Join(dir, configs.DEFAULT_FLASHBOTS_KEY)
+}
+
+// OpenOrCreateKeystore opens the keystore at path like OpenKeystore. When there is no file yet,
+// it generates a key and stores it there encrypted, reporting created.
+func OpenOrCreateKeystore(path, passwordFile string) (s *KeySigner, created bool, err error) {
+	if _, err := os.Stat(path); err == nil {
+		s, err := OpenKeystore(path, passwordFile)
+		return s, false, err
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, fmt.Errorf("failed to check keystore: %v", err)
+	}
+
+	password, err := newPassword(passwordFile, path)
+	if err != nil {
+		return nil, false, err
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate key: %v", err)
+	}
+	keyJSON, err := keystore.EncryptKey(&keystore.Key{
+		Id:         uuid.New(),
+		Address:    crypto.PubkeyToAddress(key.PublicKey),
+		PrivateKey: key,
+	}, password, scryptN, scryptP)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encrypt key: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, fmt.Errorf("failed to create keystore directory: %v", err)
+	}
+	// O_EXCL: never replace a key that appeared in the meantime
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create keystore: %v", err)
+	}
+	if _, err := f.Write(keyJSON); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, false, fmt.Errorf("failed to write keystore: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return nil, false, fmt.Errorf("failed to write keystore: %v", err)
+	}
+	return NewKeySigner(key), true, nil
+}
+
+// newPassword reads the password of a new keystore from passwordFile, or prompts for it twice
+// on the terminal. Empty passwords are refused since they leave the key unprotected.
+func newPassword(passwordFile, path string) (string, error) {
+	password, err := ReadPassword(passwordFile, "New password for "+path)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("refusing to store %s with an empty password", path)
+	}
+	if passwordFile == "" && term.IsTerminal(int(os.Stdin.Fd())) {
+		confirmation, err := ReadPassword("", "Repeat password")
+		if err != nil {
+			return "", err
+		}
+		if confirmation != password {
+			return "", fmt.Errorf("passwords do not match")
+		}
+	}
+	return password, nil
+}
+
+// openReputationKey loads the Flashbots reputation key of config, creating it on first run.
+func openReputationKey(config *configs.Config) (*KeySigner, error) {
+	path := ReputationKeystorePath(config)
+	s, created, err := OpenOrCreateKeystore(path, config.FlashbotsPasswordFile)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		log.Printf("🔑 Created Flashbots reputation key %s in %s", s.Address().Hex(), path)
+	}
+	return s, nil
+}
+
+// openExistingReputationKey loads the Flashbots reputation key of config and fails when there is
+// none yet.
+func openExistingReputationKey(config *configs.Config) (*KeySigner, error) {
+	path := ReputationKeystorePath(config)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no Flashbots reputation key at %s; it is created on the first run of the bot", path)
+	}
+	return OpenKeystore(path, config.FlashbotsPasswordFile)
+}
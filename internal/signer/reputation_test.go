@@ -0,0 +1,94 @@
+package signer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+)
+
+func init() {
+	scryptN, scryptP = keystore.LightScryptN, keystore.LightScryptP
+}
+
+func TestReputationKeyIsCreatedOnceNextToConfig(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("reputation\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+	config := &configs.Config{ConfigFile: filepath.Join(dir, "config.yaml"), FlashbotsPasswordFile: passwordFile}
+
+	first, err := ForFlashbots(context.Background(), config, common.Address{})
+	if err != nil {
+		t.Fatalf("failed to create reputation key: %v", err)
+	}
+	path := filepath.Join(dir, configs.DEFAULT_FLASHBOTS_KEY)
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reputation key not stored next to the config: %v", err)
+	}
+	if strings.Contains(string(keyJSON), "privateKey") || !strings.Contains(string(keyJSON), "ciphertext") {
+		t.Errorf("reputation key is not stored encrypted: %s", keyJSON)
+	}
+
+	second, err := ForFlashbots(context.Background(), config, common.Address{})
+	if err != nil {
+		t.Fatalf("failed to reopen reputation key: %v", err)
+	}
+	if second.Address() != first.Address() {
+		t.Errorf("second run created a new key %s instead of reusing %s", second.Address().Hex(), first.Address().Hex())
+	}
+}
+
+func TestForFlashbotsRefusesTheEOAKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	config := &configs.Config{FlashbotsSignerKey: hexutil.Encode(crypto.FromECDSA(key))}
+
+	if _, err := ForFlashbots(context.Background(), config, crypto.PubkeyToAddress(key.PublicKey)); err == nil {
+		t.Error("expected the trading account's key to be refused as the Flashbots signer")
+	}
+}
+
+func TestOpenFlashbotsNeverCreatesAKey(t *testing.T) {
+	dir := t.TempDir()
+	config := &configs.Config{ConfigFile: filepath.Join(dir, "config.yaml")}
+
+	if _, err := OpenFlashbots(context.Background(), config, common.Address{}); err == nil {
+		t.Fatal("expected a missing reputation key to be an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, configs.DEFAULT_FLASHBOTS_KEY)); !os.IsNotExist(err) {
+		t.Errorf("OpenFlashbots created a reputation key: %v", err)
+	}
+}
+
+func TestEOAAddressReadsTheKeystoreWithoutUnlocking(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	account, err := keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP).ImportECDSA(key, "trading")
+	if err != nil {
+		t.Fatalf("failed to import key: %v", err)
+	}
+
+	// No password file and no terminal: any attempt to decrypt would fail
+	address, err := EOAAddress(context.Background(), &configs.Config{EoaKeystore: account.URL.Path})
+	if err != nil {
+		t.Fatalf("EOAAddress failed: %v", err)
+	}
+	if address != account.Address {
+		t.Errorf("resolved %s, want %s", address.Hex(), account.Address.Hex())
+	}
+}
@@ -0,0 +1,59 @@
+// Package signer signs transactions and messages for an account without the rest of the bot
+// handling its private key. Keys come from an encrypted keystore file, from a clef-style
+// external signer, or, for development only, from a raw hex key.
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Signer signs on behalf of one account. Message signatures are 65 bytes [R || S || V] with V
+// 0 or 1, like crypto.Sign.
+type Signer interface {
+	Address() common.Address
+	// SignTx signs tx for chainID.
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	// SignText signs text as an EIP-191 personal message.
+	SignText(ctx context.Context, text []byte) ([]byte, error)
+	// SignTypedData signs an EIP-712 message.
+	SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error)
+}
+
+// KeySigner signs with a private key held in memory.
+type KeySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+func NewKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func (s *KeySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *KeySigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+func (s *KeySigner) SignText(ctx context.Context, text []byte) ([]byte, error) {
+	return crypto.Sign(accounts.TextHash(text), s.key)
+}
+
+func (s *KeySigner) SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash typed data: %v", err)
+	}
+	return crypto.Sign(hash, s.key)
+}
@@ -0,0 +1,193 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+func TestOpenKeystore(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	account, err := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP).ImportECDSA(key, "correct horse")
+	if err != nil {
+		t.Fatalf("failed to import key: %v", err)
+	}
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("correct horse\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+
+	s, err := OpenKeystore(account.URL.Path, passwordFile)
+	if err != nil {
+		t.Fatalf("OpenKeystore failed: %v", err)
+	}
+	if s.Address() != account.Address {
+		t.Errorf("keystore signs as %s, want %s", s.Address().Hex(), account.Address.Hex())
+	}
+
+	if err := os.WriteFile(passwordFile, []byte("battery staple\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+	if _, err := OpenKeystore(account.URL.Path, passwordFile); err == nil {
+		t.Error("expected a wrong password to be rejected")
+	}
+}
+
+// fakeClef serves the account_ namespace of clef, approving every request.
+type fakeClef struct {
+	key *KeySigner
+}
+
+func (c *fakeClef) List() []common.Address {
+	return []common.Address{c.key.Address()}
+}
+
+func (c *fakeClef) SignTransaction(ctx context.Context, args apitypes.SendTxArgs) (*signTransactionResult, error) {
+	tx, err := args.ToTransaction()
+	if err != nil {
+		return nil, err
+	}
+	signed, err := c.key.SignTx(ctx, tx, (*big.Int)(args.ChainID))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &signTransactionResult{Raw: raw, Tx: signed}, nil
+}
+
+func (c *fakeClef) SignData(ctx context.Context, contentType string, address common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	sig, err := c.key.SignText(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+func (c *fakeClef) SignTypedData(ctx context.Context, address common.MixedcaseAddress, data apitypes.TypedData) (hexutil.Bytes, error) {
+	sig, err := c.key.SignTypedData(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+func TestExternalSignerMatchesKey(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	local := NewKeySigner(key)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &fakeClef{key: local}); err != nil {
+		t.Fatalf("failed to register fake clef: %v", err)
+	}
+	t.Cleanup(server.Stop)
+	external, err := NewExternal(ctx, rpc.DialInProc(server), common.Address{})
+	if err != nil {
+		t.Fatalf("NewExternal failed: %v", err)
+	}
+	if external.Address() != local.Address() {
+		t.Fatalf("external signer picked %s, want %s", external.Address().Hex(), local.Address().Hex())
+	}
+
+	chainID := big.NewInt(1)
+	to := common.HexToAddress("0x0000000000000000000000000000000000007070")
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     7,
+		GasTipCap: big.NewInt(params.GWei),
+		GasFeeCap: big.NewInt(30 * params.GWei),
+		Gas:       100000,
+		To:        &to,
+		Value:     big.NewInt(params.Ether),
+		Data:      []byte{0xde, 0xad},
+	})
+	want, err := local.SignTx(ctx, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign locally: %v", err)
+	}
+	got, err := external.SignTx(ctx, tx, chainID)
+	if err != nil {
+		t.Fatalf("external SignTx failed: %v", err)
+	}
+	if got.Hash() != want.Hash() {
+		t.Errorf("external transaction %s differs from local %s", got.Hash().Hex(), want.Hash().Hex())
+	}
+
+	text := []byte("0x1234")
+	wantSig, _ := local.SignText(ctx, text)
+	gotSig, err := external.SignText(ctx, text)
+	if err != nil {
+		t.Fatalf("external SignText failed: %v", err)
+	}
+	if !bytes.Equal(gotSig, wantSig) {
+		t.Errorf("external text signature %x differs from local %x", gotSig, wantSig)
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(text), gotSig)
+	if err != nil || crypto.PubkeyToAddress(*pub) != local.Address() {
+		t.Errorf("text signature does not recover to the signer: %v", err)
+	}
+
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {{Name: "name", Type: "string"}, {Name: "chainId", Type: "uint256"}},
+			"Mail":         {{Name: "contents", Type: "string"}},
+		},
+		PrimaryType: "Mail",
+		Domain:      apitypes.TypedDataDomain{Name: "test", ChainId: math.NewHexOrDecimal256(1)},
+		Message:     apitypes.TypedDataMessage{"contents": "hello"},
+	}
+	wantSig, err = local.SignTypedData(ctx, typedData)
+	if err != nil {
+		t.Fatalf("failed to sign typed data locally: %v", err)
+	}
+	gotSig, err = external.SignTypedData(ctx, typedData)
+	if err != nil {
+		t.Fatalf("external SignTypedData failed: %v", err)
+	}
+	if !bytes.Equal(gotSig, wantSig) {
+		t.Errorf("external typed data signature %x differs from local %x", gotSig, wantSig)
+	}
+}
+
+func TestNewExternalRejectsUnknownAccount(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &fakeClef{key: NewKeySigner(key)}); err != nil {
+		t.Fatalf("failed to register fake clef: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	other := common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	if _, err := NewExternal(context.Background(), rpc.DialInProc(server), other); err == nil {
+		t.Error("expected an account the signer does not manage to be rejected")
+	}
+}
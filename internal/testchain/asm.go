@@ -0,0 +1,286 @@
+package testchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// program assembles EVM code. Jump targets are named labels resolved when the code is finished,
+// and local variables live in memory words from varBase up, so the contracts below can be
+// written as straight-line sequences without tracking deep stacks. Subroutines are entered with
+// call, which leaves the return address on the stack for ret; they share the variables, so each
+// one documents which it reads and writes.
+type program struct {
+	code   []byte
+	labels map[string]int
+	fixups map[int]string
+	blobs  []blob
+	next   int
+}
+
+// blob is data embedded after the code, such as the creation code a factory deploys.
+type blob struct {
+	name string
+	data []byte
+}
+
+// Memory layout: words 0x00-0x7f are hashing and return scratch, variables start at varBase,
+// external calls are encoded into and answered in callBuf, and the router keeps its amounts[]
+// at amountsBuf, right behind the word that makes it an ABI return value.
+const (
+	varBase    = 0x80
+	callBuf    = 0x1000
+	hashBuf    = 0x1800
+	amountsBuf = 0x2000
+	initBuf    = 0x4000
+)
+
+func newProgram() *program {
+	return &program{labels: make(map[string]int), fixups: make(map[int]string)}
+}
+
+func (p *program) op(ops ...vm.OpCode) *program {
+	for _, op := range ops {
+		p.code = append(p.code, byte(op))
+	}
+	return p
+}
+
+// push emits the shortest PUSH of v, which is an integer, a *big.Int, an address, a hash or raw bytes.
+func (p *program) push(v interface{}) *program {
+	var b []byte
+	switch v := v.(type) {
+	case int:
+		b = big.NewInt(int64(v)).Bytes()
+	case int64:
+		b = big.NewInt(v).Bytes()
+	case uint64:
+		b = new(big.Int).SetUint64(v).Bytes()
+	case *big.Int:
+		b = v.Bytes()
+	case common.Address:
+		b = new(big.Int).SetBytes(v.Bytes()).Bytes()
+	case common.Hash:
+		b = new(big.Int).SetBytes(v.Bytes()).Bytes()
+	case []byte:
+		b = v
+	default:
+		panic(fmt.Sprintf("cannot push %T", v))
+	}
+	if len(b) == 0 {
+		return p.op(vm.PUSH0)
+	}
+	if len(b) > 32 {
+		panic("push wider than 32 bytes")
+	}
+	p.code = append(p.code, byte(vm.PUSH1)+byte(len(b)-1))
+	p.code = append(p.code, b...)
+	return p
+}
+
+func (p *program) label(name string) *program {
+	if _, ok := p.labels[name]; ok {
+		panic("duplicate label " + name)
+	}
+	p.labels[name] = len(p.code)
+	return p.op(vm.JUMPDEST)
+}
+
+// fresh returns a label name no other part of the program uses.
+func (p *program) fresh(prefix string) string {
+	p.next++
+	return fmt.Sprintf("%s.%d", prefix, p.next)
+}
+
+// pushLabel pushes the offset of a label or an embedded blob.
+func (p *program) pushLabel(name string) *program {
+	p.code = append(p.code, byte(vm.PUSH2))
+	p.fixups[len(p.code)] = name
+	p.code = append(p.code, 0, 0)
+	return p
+}
+
+func (p *program) jump(name string) *program {
+	return p.pushLabel(name).op(vm.JUMP)
+}
+
+// jumpi jumps to name if the top of the stack is non-zero, consuming it.
+func (p *program) jumpi(name string) *program {
+	return p.pushLabel(name).op(vm.JUMPI)
+}
+
+// call runs the subroutine at label name and continues after it once it returns.
+func (p *program) call(name string) *program {
+	back := p.fresh(name)
+	return p.pushLabel(back).jump(name).label(back)
+}
+
+// ret returns from a subroutine whose body left the stack as it found it.
+func (p *program) ret() *program {
+	return p.op(vm.JUMP)
+}
+
+// embed places data after the code; pushLabel(name) pushes its offset.
+func (p *program) embed(name string, data []byte) *program {
+	p.blobs = append(p.blobs, blob{name: name, data: data})
+	return p
+}
+
+// set pops the top of the stack into variable v.
+func (p *program) set(v int) *program {
+	return p.push(varBase + 32*v).op(vm.MSTORE)
+}
+
+// get pushes variable v.
+func (p *program) get(v int) *program {
+	return p.push(varBase + 32*v).op(vm.MLOAD)
+}
+
+// arg pushes the i-th static calldata word after the selector.
+func (p *program) arg(i int) *program {
+	return p.push(4 + 32*i).op(vm.CALLDATALOAD)
+}
+
+// require reverts unless the top of the stack is non-zero, consuming it.
+func (p *program) require() *program {
+	return p.op(vm.ISZERO).jumpi("revert")
+}
+
+// mapping replaces the key on top of the stack with its storage slot in the mapping at slot.
+func (p *program) mapping(slot int) *program {
+	return p.push(0).op(vm.MSTORE).push(slot).push(32).op(vm.MSTORE).push(64).push(0).op(vm.KECCAK256)
+}
+
+// nestedMapping replaces outer (top) and inner (below it) with the slot of m[outer][inner] in
+// the mapping of mappings at slot.
+func (p *program) nestedMapping(slot int) *program {
+	p.mapping(slot)
+	return p.push(32).op(vm.MSTORE).push(0).op(vm.MSTORE).push(64).push(0).op(vm.KECCAK256)
+}
+
+// returnWords returns the top n stack words, the topmost one first.
+func (p *program) returnWords(n int) *program {
+	for i := 0; i < n; i++ {
+		p.push(32 * i).op(vm.MSTORE)
+	}
+	return p.push(32 * n).push(0).op(vm.RETURN)
+}
+
+// returnString returns s, at most 32 bytes, as an ABI-encoded string.
+func (p *program) returnString(s string) *program {
+	return p.push(common.RightPadBytes([]byte(s), 32)).push(len(s)).push(32).returnWords(3)
+}
+
+// dispatch jumps to the label of each selector whose signature matches the call and to
+// fallback otherwise, which reverts when empty. Every contract ends with the shared "revert" label.
+func (p *program) dispatch(methods map[string]string, fallback string) *program {
+	signatures := make([]string, 0, len(methods))
+	for signature := range methods {
+		signatures = append(signatures, signature)
+	}
+	// Sorted so that the same contract always assembles to the same code
+	sort.Strings(signatures)
+
+	p.push(0).op(vm.CALLDATALOAD).push(0xe0).op(vm.SHR)
+	for _, signature := range signatures {
+		p.op(vm.DUP1).push(crypto.Keccak256([]byte(signature))[:4]).op(vm.EQ).jumpi(methods[signature])
+	}
+	if fallback == "" {
+		fallback = "revert"
+	}
+	return p.jump(fallback)
+}
+
+// assemble appends the shared revert block and the embedded blobs, and resolves the labels.
+func (p *program) assemble() []byte {
+	p.label("revert").push(0).push(0).op(vm.REVERT)
+	for _, b := range p.blobs {
+		if _, ok := p.labels[b.name]; ok {
+			panic("duplicate label " + b.name)
+		}
+		p.labels[b.name] = len(p.code)
+		p.code = append(p.code, b.data...)
+	}
+	for offset, name := range p.fixups {
+		target, ok := p.labels[name]
+		if !ok {
+			panic("undefined label " + name)
+		}
+		p.code[offset] = byte(target >> 8)
+		p.code[offset+1] = byte(target)
+	}
+	return p.code
+}
+
+// operand pushes one word, so that the helpers below take their inputs as arguments.
+type operand func(p *program)
+
+// local is variable v.
+func local(v int) operand { return func(p *program) { p.get(v) } }
+
+// constant is an integer, an address or raw bytes, as taken by push.
+func constant(v interface{}) operand { return func(p *program) { p.push(v) } }
+
+// param is the i-th static calldata word.
+func param(i int) operand { return func(p *program) { p.arg(i) } }
+
+// stored is the word in storage slot.
+func stored(slot int) operand { return func(p *program) { p.push(slot).op(vm.SLOAD) } }
+
+// env is the word an opcode such as CALLER or CALLVALUE pushes.
+func env(op vm.OpCode) operand { return func(p *program) { p.op(op) } }
+
+// result is the i-th word returned by the last invoke.
+func result(i int) operand { return func(p *program) { p.push(callBuf + 32*i).op(vm.MLOAD) } }
+
+// assign sets variable v to o.
+func (p *program) assign(v int, o operand) *program {
+	o(p)
+	return p.set(v)
+}
+
+// requireAtLeast reverts unless a >= b.
+func (p *program) requireAtLeast(a, b operand) *program {
+	b(p)
+	a(p)
+	return p.op(vm.LT).op(vm.ISZERO).require()
+}
+
+// requireDeadline reverts once the block timestamp passes argument i.
+func (p *program) requireDeadline(i int) *program {
+	return p.requireAtLeast(param(i), env(vm.TIMESTAMP))
+}
+
+// invoke calls signature on target, sending value wei, with static word arguments and reverts
+// if the call fails. Up to three words of its return data are then available as result(i).
+func (p *program) invoke(target, value operand, signature string, args ...operand) *program {
+	for _, arg := range args {
+		arg(p)
+	}
+	p.push(selectorWord(signature)).push(callBuf).op(vm.MSTORE)
+	for i := len(args) - 1; i >= 0; i-- {
+		p.push(callBuf + 4 + 32*i).op(vm.MSTORE)
+	}
+	p.push(0x60).push(callBuf).push(4 + 32*len(args)).push(callBuf)
+	value(p)
+	target(p)
+	return p.op(vm.GAS, vm.CALL).require()
+}
+
+// returnedTrue reverts if the last invoke returned false, accepting tokens that return nothing.
+func (p *program) returnedTrue() *program {
+	return p.op(vm.RETURNDATASIZE, vm.ISZERO).push(callBuf).op(vm.MLOAD).op(vm.OR).require()
+}
+
+// send transfers amount wei to to and reverts if the recipient rejects it.
+func (p *program) send(to, amount operand) *program {
+	p.push(0).push(0).push(0).push(0)
+	amount(p)
+	to(p)
+	return p.op(vm.GAS, vm.CALL).require()
+}
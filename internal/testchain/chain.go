@@ -0,0 +1,327 @@
+// Package testchain runs the bot offline: an in-process chain with WETH9, a Uniswap V2 factory
+// and router, pools of a test token, an intermediate token and a fee-on-transfer token, and a
+// relay that checks Flashbots signatures and applies bundles to that chain.
+package testchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/configs"
+	"github.com/nimazeighami/flash-liquswap-sync/internal/signer"
+)
+
+// Deployment addresses. The tokens sort below WETH, so each is token0 of its WETH pair; the
+// pairs themselves are created by the factory at PairAddress.
+var (
+	TokenAddress    = common.HexToAddress("0x0000000000000000000000000000000000007070")
+	MidTokenAddress = common.HexToAddress("0x0000000000000000000000000000000000007071")
+	FeeTokenAddress = common.HexToAddress("0x0000000000000000000000000000000000007072")
+	FactoryAddress  = common.HexToAddress("0x000000000000000000000000000000000000FAC7")
+	RouterAddress   = common.HexToAddress("0x0000000000000000000000000000000000000707")
+	WETHAddress     = common.HexToAddress(configs.WETH_ADDRESS)
+)
+
+// FeeTokenBps is the share of every FOT transfer that is burned, in basis points.
+const FeeTokenBps = 100
+
+// Initial pools, seeded through the router: TKN/WETH at 1000 TKN to 10 ETH, MID/WETH at 10000 MID
+// to 10 ETH, MID/TKN at 10000 MID to 2000 TKN, which makes WETH → MID → TKN the better route for
+// buying TKN, and FOT/WETH at 1000 FOT to 10 ETH before the transfer fee.
+var (
+	InitialTokenReserve = ether(1000)
+	InitialETHReserve   = ether(10)
+	InitialMidReserve   = ether(10000)
+	midTokenReserve     = ether(2000)
+
+	// EOABalance is the ETH the test account starts with.
+	EOABalance = ether(100)
+
+	// providerBalance is the ETH of the account that seeds the pools and of the trader.
+	providerBalance = ether(1000)
+)
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.Ether))
+}
+
+// Chain is a simulated chain with WETH9, the tokens and the Uniswap V2 factory and router in its
+// genesis, and the pools created and funded by transactions in the first blocks. Later blocks
+// are only mined by Commit, which the relay calls when it includes a bundle.
+type Chain struct {
+	Backend *simulated.Backend
+	Client  *ethclient.Client
+	RPC     *rpc.Client
+	ChainID *big.Int
+
+	// EOAKey is the funded trading account, which holds no tokens; FlashbotsKey only signs relay
+	// requests.
+	EOAKey       *ecdsa.PrivateKey
+	FlashbotsKey *ecdsa.PrivateKey
+
+	// providerKey seeded the pools and traderKey signs the trades that compete with bundles.
+	providerKey *ecdsa.PrivateKey
+	traderKey   *ecdsa.PrivateKey
+}
+
+// New starts a chain that is shut down when t completes.
+func New(t testing.TB) *Chain {
+	t.Helper()
+
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		keys[i] = key
+	}
+	eoaKey, flashbotsKey, providerKey, traderKey := keys[0], keys[1], keys[2], keys[3]
+	provider := crypto.PubkeyToAddress(providerKey.PublicKey)
+
+	midTotal := new(big.Int).Add(InitialMidReserve, InitialMidReserve)
+	alloc := types.GenesisAlloc{
+		crypto.PubkeyToAddress(eoaKey.PublicKey):    {Balance: EOABalance},
+		provider:                                    {Balance: providerBalance},
+		crypto.PubkeyToAddress(traderKey.PublicKey): {Balance: providerBalance},
+		TokenAddress:                                tokenAccount("TKN", 0, provider, new(big.Int).Add(InitialTokenReserve, midTokenReserve)),
+		MidTokenAddress:                             tokenAccount("MID", 0, provider, midTotal),
+		FeeTokenAddress:                             tokenAccount("FOT", FeeTokenBps, provider, InitialTokenReserve),
+		WETHAddress:                                 {Code: wethCode(), Balance: big.NewInt(0)},
+		FactoryAddress:                              {Code: factoryCode()},
+		RouterAddress:                               {Code: routerCode(FactoryAddress, WETHAddress)},
+	}
+
+	// The bot takes a concrete *ethclient.Client, so the node is reached over IPC rather than
+	// through the simulated client interface
+	ipcPath := filepath.Join(t.TempDir(), "chain.ipc")
+	backend := simulated.NewBackend(alloc, func(nodeConf *node.Config, ethConf *ethconfig.Config) {
+		nodeConf.IPCPath = ipcPath
+	})
+	t.Cleanup(func() { backend.Close() })
+
+	rpcClient, err := rpc.Dial(ipcPath)
+	if err != nil {
+		t.Fatalf("failed to attach to simulated chain: %v", err)
+	}
+	t.Cleanup(rpcClient.Close)
+	client := ethclient.NewClient(rpcClient)
+
+	chainID, err := client.ChainID(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get chain ID: %v", err)
+	}
+
+	c := &Chain{
+		Backend:      backend,
+		Client:       client,
+		RPC:          rpcClient,
+		ChainID:      chainID,
+		EOAKey:       eoaKey,
+		FlashbotsKey: flashbotsKey,
+		providerKey:  providerKey,
+		traderKey:    traderKey,
+	}
+	c.seed(t)
+	return c
+}
+
+// tokenAccount is the genesis account of a token whose whole supply is held by holder.
+func tokenAccount(symbol string, feeBps int64, holder common.Address, supply *big.Int) types.Account {
+	return types.Account{
+		Code: tokenCode(symbol, feeBps),
+		Storage: map[common.Hash]common.Hash{
+			mappingKey(holder, tokenBalancesSlot):         common.BigToHash(supply),
+			common.BigToHash(big.NewInt(tokenSupplySlot)): common.BigToHash(supply),
+		},
+	}
+}
+
+// seed creates and funds the pools through the router, the way liquidity reaches a live
+// deployment, each call in a block of its own.
+func (c *Chain) seed(t testing.TB) {
+	t.Helper()
+	provider := crypto.PubkeyToAddress(c.providerKey.PublicKey)
+	unlimited := abi.MaxUint256
+	for _, token := range []common.Address{TokenAddress, MidTokenAddress, FeeTokenAddress} {
+		c.transact(t, c.providerKey, token, nil, callData("approve(address,uint256)", RouterAddress, unlimited))
+	}
+
+	addLiquidityETH := "addLiquidityETH(address,uint256,uint256,uint256,address,uint256)"
+	for _, pool := range []struct {
+		token  common.Address
+		amount *big.Int
+	}{
+		{TokenAddress, InitialTokenReserve},
+		{MidTokenAddress, InitialMidReserve},
+		{FeeTokenAddress, InitialTokenReserve},
+	} {
+		data := callData(addLiquidityETH, pool.token, pool.amount, common.Big0, common.Big0, provider, unlimited)
+		c.transact(t, c.providerKey, RouterAddress, InitialETHReserve, data)
+	}
+	addLiquidity := "addLiquidity(address,address,uint256,uint256,uint256,uint256,address,uint256)"
+	data := callData(addLiquidity, MidTokenAddress, TokenAddress, InitialMidReserve, midTokenReserve, common.Big0, common.Big0, provider, unlimited)
+	c.transact(t, c.providerKey, RouterAddress, nil, data)
+}
+
+// EOA is the address of the trading account.
+func (c *Chain) EOA() common.Address {
+	return crypto.PubkeyToAddress(c.EOAKey.PublicKey)
+}
+
+// EOASigner signs with EOAKey.
+func (c *Chain) EOASigner() *signer.KeySigner {
+	return signer.NewKeySigner(c.EOAKey)
+}
+
+// FlashbotsSigner signs with FlashbotsKey.
+func (c *Chain) FlashbotsSigner() *signer.KeySigner {
+	return signer.NewKeySigner(c.FlashbotsKey)
+}
+
+// Config zaps ethAmount into the test pool on the V2 path, submitting to relayURL.
+func (c *Chain) Config(relayURL string, ethAmount *big.Int) *configs.Config {
+	return &configs.Config{
+		RpcURL:            "simulated",
+		ChainID:           c.ChainID.Int64(),
+		WETHAddress:       WETHAddress,
+		PathBaseTokens:    []common.Address{WETHAddress},
+		RelayURL:          relayURL,
+		EthAmount:         ethAmount,
+		TokenAddress:      TokenAddress,
+		SlippageTolerance: configs.DEFAULT_SLIPPAGE,
+		DeadlineSeconds:   configs.DEFAULT_DEADLINE_SECONDS,
+		BlockWindow:       configs.DEFAULT_BLOCK_WINDOW,
+		RequoteBps:        configs.DEFAULT_REQUOTE_BPS,
+		Relays:            []string{"flashbots"},
+		Operation:         configs.OPERATION_ZAP,
+		SubmissionMode:    configs.SUBMISSION_MODE_BUNDLE,
+		Dex:               configs.DEX_UNISWAP_V2,
+		RouterAddress:     RouterAddress,
+		FactoryAddress:    FactoryAddress,
+		V3FeeTier:         configs.DEFAULT_V3_FEE_TIER,
+		Gas:               configs.DefaultGasTuning(),
+	}
+}
+
+// TokenBalance is the test token balance of account.
+func (c *Chain) TokenBalance(t testing.TB, account common.Address) *big.Int {
+	t.Helper()
+	return c.BalanceOf(t, TokenAddress, account)
+}
+
+// LPBalance is the TKN/WETH pair's LP token balance of account.
+func (c *Chain) LPBalance(t testing.TB, account common.Address) *big.Int {
+	t.Helper()
+	return c.BalanceOf(t, PairAddress(TokenAddress, WETHAddress), account)
+}
+
+// BalanceOf is the token balance of account.
+func (c *Chain) BalanceOf(t testing.TB, token, account common.Address) *big.Int {
+	t.Helper()
+	to := token
+	result, err := c.Client.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: callData("balanceOf(address)", account)}, nil)
+	if err != nil {
+		t.Fatalf("balanceOf on %s failed: %v", token.Hex(), err)
+	}
+	return new(big.Int).SetBytes(result)
+}
+
+// Trade returns a signed swap of ethAmount for TKN on the TKN/WETH pair by another account, for
+// a relay to mine ahead of a bundle.
+func (c *Chain) Trade(t testing.TB, ethAmount *big.Int) *types.Transaction {
+	t.Helper()
+	swap := "swapExactETHForTokens(uint256,address[],address,uint256)"
+	trader := crypto.PubkeyToAddress(c.traderKey.PublicKey)
+	data := callData(swap, common.Big0, []common.Address{WETHAddress, TokenAddress}, trader, abi.MaxUint256)
+	return c.sign(t, c.traderKey, RouterAddress, ethAmount, data)
+}
+
+// transact mines a transaction from key and fails t unless it succeeds.
+func (c *Chain) transact(t testing.TB, key *ecdsa.PrivateKey, to common.Address, value *big.Int, data []byte) {
+	t.Helper()
+	ctx := context.Background()
+	tx := c.sign(t, key, to, value, data)
+	if err := c.Client.SendTransaction(ctx, tx); err != nil {
+		t.Fatalf("failed to send transaction to %s: %v", to.Hex(), err)
+	}
+	c.Backend.Commit()
+	receipt, err := c.Client.TransactionReceipt(ctx, tx.Hash())
+	if err != nil {
+		t.Fatalf("failed to get receipt of %s: %v", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("transaction to %s reverted", to.Hex())
+	}
+}
+
+// sign signs a call from key at its next pending nonce, paying twice the current base fee.
+func (c *Chain) sign(t testing.TB, key *ecdsa.PrivateKey, to common.Address, value *big.Int, data []byte) *types.Transaction {
+	t.Helper()
+	ctx := context.Background()
+	nonce, err := c.Client.PendingNonceAt(ctx, crypto.PubkeyToAddress(key.PublicKey))
+	if err != nil {
+		t.Fatalf("failed to get nonce: %v", err)
+	}
+	header, err := c.Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to get latest block: %v", err)
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	tip := big.NewInt(params.GWei)
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(c.ChainID), &types.DynamicFeeTx{
+		ChainID:   c.ChainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), tip),
+		Gas:       5_000_000,
+		To:        &to,
+		Value:     value,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// callData ABI-encodes a call of signature with address, *big.Int and address[] arguments.
+func callData(signature string, args ...interface{}) []byte {
+	head := crypto.Keccak256([]byte(signature))[:4]
+	var tail []byte
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case common.Address:
+			head = append(head, common.LeftPadBytes(arg.Bytes(), 32)...)
+		case *big.Int:
+			head = append(head, common.LeftPadBytes(arg.Bytes(), 32)...)
+		case []common.Address:
+			head = append(head, common.LeftPadBytes(big.NewInt(int64(32*len(args)+len(tail))).Bytes(), 32)...)
+			tail = append(tail, common.LeftPadBytes(big.NewInt(int64(len(arg))).Bytes(), 32)...)
+			for _, address := range arg {
+				tail = append(tail, common.LeftPadBytes(address.Bytes(), 32)...)
+			}
+		default:
+			panic(fmt.Sprintf("cannot encode %T", arg))
+		}
+	}
+	return append(head, tail...)
+}
@@ -0,0 +1,793 @@
+package testchain
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The contracts below follow WETH9 and the Uniswap V2 core and periphery contracts function by
+// function: the same entry points, checks and arithmetic, and pairs created by the factory with
+// CREATE2 at the address the router derives from the pair's init code hash. Events, permit,
+// protocol fees, price accumulators and flash swaps are left out.
+
+// Storage layouts. Tokens keep balances, allowances and supply like OpenZeppelin's ERC20 and
+// WETH9 like its Solidity source, so genesis balances can be written directly. The pair keeps
+// the slots of UniswapV2ERC20 and UniswapV2Pair, with the reserves unpacked.
+const (
+	tokenBalancesSlot   = 0
+	tokenAllowancesSlot = 1
+	tokenSupplySlot     = 2
+
+	wethBalancesSlot   = 3
+	wethAllowancesSlot = 4
+
+	pairSupplySlot     = 0
+	pairBalancesSlot   = 1
+	pairAllowancesSlot = 2
+	pairFactorySlot    = 5
+	pairToken0Slot     = 6
+	pairToken1Slot     = 7
+	pairReserve0Slot   = 8
+	pairReserve1Slot   = 9
+	pairTimestampSlot  = 10
+
+	factoryPairsSlot    = 2
+	factoryAllPairsSlot = 3
+)
+
+// minimumLiquidity is the LP supply the first mint of a pair locks at the zero address.
+const minimumLiquidity = 1000
+
+// selectorWord is the 4-byte selector of signature left-aligned in a 32-byte word.
+func selectorWord(signature string) []byte {
+	return common.RightPadBytes(crypto.Keccak256([]byte(signature))[:4], 32)
+}
+
+// symbolWord is symbol as bytes32, the way early tokens return their symbol and name.
+func symbolWord(symbol string) []byte {
+	return common.RightPadBytes([]byte(symbol), 32)
+}
+
+// erc20Layout is where an ERC-20 keeps its state. A negative supply slot makes the total supply
+// the contract's ETH balance, as in WETH9.
+type erc20Layout struct {
+	balances, allowances, supply int
+}
+
+// erc20Methods are the dispatch entries of the bodies erc20 emits.
+func erc20Methods() map[string]string {
+	return map[string]string{
+		"balanceOf(address)":                    "balanceOf",
+		"allowance(address,address)":            "allowance",
+		"approve(address,uint256)":              "approve",
+		"transfer(address,uint256)":             "transfer",
+		"transferFrom(address,address,uint256)": "transferFrom",
+		"totalSupply()":                         "totalSupply",
+	}
+}
+
+// erc20 emits the ERC-20 methods for layout. An unlimited allowance is never spent, and with a
+// non-zero feeBps every transfer burns that share of the amount before crediting the recipient.
+func (p *program) erc20(layout erc20Layout, feeBps int64) *program {
+	p.label("balanceOf").arg(0).mapping(layout.balances).op(vm.SLOAD).returnWords(1)
+	p.label("allowance").arg(1).arg(0).nestedMapping(layout.allowances).op(vm.SLOAD).returnWords(1)
+	p.label("totalSupply")
+	if layout.supply < 0 {
+		p.op(vm.SELFBALANCE)
+	} else {
+		p.push(layout.supply).op(vm.SLOAD)
+	}
+	p.returnWords(1)
+
+	p.label("approve").arg(1).arg(0).op(vm.CALLER).nestedMapping(layout.allowances).op(vm.SSTORE)
+	p.push(1).returnWords(1)
+
+	p.label("transfer").op(vm.CALLER).set(0).arg(0).set(1).arg(1).set(2)
+	p.move(layout, feeBps).push(1).returnWords(1)
+
+	p.label("transferFrom").arg(0).set(0).arg(1).set(1).arg(2).set(2)
+	p.op(vm.CALLER).get(0).nestedMapping(layout.allowances).op(vm.DUP1, vm.SLOAD)
+	p.op(vm.DUP1, vm.NOT, vm.ISZERO).jumpi("unlimited")
+	p.get(2).op(vm.DUP2, vm.LT).op(vm.ISZERO).require()
+	p.get(2).op(vm.SWAP1, vm.SUB, vm.SWAP1, vm.SSTORE).jump("spent")
+	p.label("unlimited").op(vm.POP, vm.POP)
+	p.label("spent")
+	return p.move(layout, feeBps).push(1).returnWords(1)
+}
+
+// move transfers variable 2 tokens from the address in variable 0 to the one in variable 1,
+// burning feeBps of them on the way.
+func (p *program) move(layout erc20Layout, feeBps int64) *program {
+	p.get(0).mapping(layout.balances).op(vm.DUP1, vm.SLOAD)
+	p.get(2).op(vm.DUP2, vm.LT).op(vm.ISZERO).require()
+	p.get(2).op(vm.SWAP1, vm.SUB, vm.SWAP1, vm.SSTORE)
+	if feeBps > 0 {
+		p.push(10000).get(2).push(feeBps).op(vm.MUL, vm.DIV).set(3)
+		p.get(3).get(2).op(vm.SUB).set(2)
+		p.get(3).push(layout.supply).op(vm.SLOAD).op(vm.SUB).push(layout.supply).op(vm.SSTORE)
+	}
+	p.get(1).mapping(layout.balances).op(vm.DUP1, vm.SLOAD)
+	p.get(2).op(vm.ADD, vm.SWAP1, vm.SSTORE)
+	return p
+}
+
+// tokenCode is an 18-decimal ERC-20 without events, returning symbol and name as bytes32. A
+// non-zero feeBps makes it a fee-on-transfer token.
+func tokenCode(symbol string, feeBps int64) []byte {
+	p := newProgram()
+	methods := erc20Methods()
+	methods["decimals()"] = "decimals"
+	methods["symbol()"] = "symbol"
+	methods["name()"] = "symbol"
+	p.dispatch(methods, "")
+
+	p.erc20(erc20Layout{tokenBalancesSlot, tokenAllowancesSlot, tokenSupplySlot}, feeBps)
+	p.label("decimals").push(18).returnWords(1)
+	p.label("symbol").push(symbolWord(symbol)).returnWords(1)
+
+	return p.assemble()
+}
+
+// wethCode is WETH9: ETH sent with deposit or without calldata is credited, withdraw pays it
+// back, and the total supply is the contract's balance.
+func wethCode() []byte {
+	p := newProgram()
+	methods := erc20Methods()
+	methods["deposit()"] = "deposit"
+	methods["withdraw(uint256)"] = "withdraw"
+	methods["decimals()"] = "decimals"
+	methods["symbol()"] = "symbol"
+	methods["name()"] = "name"
+	p.dispatch(methods, "deposit")
+
+	p.erc20(erc20Layout{wethBalancesSlot, wethAllowancesSlot, -1}, 0)
+	p.label("decimals").push(18).returnWords(1)
+	p.label("symbol").returnString("WETH")
+	p.label("name").returnString("Wrapped Ether")
+
+	p.label("deposit").op(vm.CALLER).mapping(wethBalancesSlot).op(vm.DUP1, vm.SLOAD)
+	p.op(vm.CALLVALUE, vm.ADD, vm.SWAP1, vm.SSTORE, vm.STOP)
+
+	p.label("withdraw").op(vm.CALLER).mapping(wethBalancesSlot).op(vm.DUP1, vm.SLOAD)
+	p.arg(0).op(vm.DUP2, vm.LT).op(vm.ISZERO).require()
+	p.arg(0).op(vm.SWAP1, vm.SUB, vm.SWAP1, vm.SSTORE)
+	p.send(env(vm.CALLER), param(0)).op(vm.STOP)
+
+	return p.assemble()
+}
+
+// Variables of pairCode.
+const (
+	pBalance0 = iota
+	pBalance1
+	pReserve0
+	pReserve1
+	pAmount0
+	pAmount1
+	pAmount0In
+	pAmount1In
+	pLiquidity
+	pSupply
+	pToken
+	pTo
+	pValue
+	pX
+	pY
+	pZ
+)
+
+// pairCode is the runtime code of UniswapV2Pair and its LP token.
+func pairCode() []byte {
+	p := newProgram()
+	methods := erc20Methods()
+	for signature, label := range map[string]string{
+		"decimals()":                          "decimals",
+		"symbol()":                            "symbol",
+		"name()":                              "name",
+		"MINIMUM_LIQUIDITY()":                 "minimumLiquidity",
+		"factory()":                           "factory",
+		"token0()":                            "token0",
+		"token1()":                            "token1",
+		"getReserves()":                       "getReserves",
+		"initialize(address,address)":         "initialize",
+		"mint(address)":                       "mint",
+		"burn(address)":                       "burn",
+		"swap(uint256,uint256,address,bytes)": "swap",
+		"sync()":                              "sync",
+	} {
+		methods[signature] = label
+	}
+	p.dispatch(methods, "")
+
+	p.erc20(erc20Layout{pairBalancesSlot, pairAllowancesSlot, pairSupplySlot}, 0)
+	p.label("decimals").push(18).returnWords(1)
+	p.label("symbol").returnString("UNI-V2")
+	p.label("name").returnString("Uniswap V2")
+	p.label("minimumLiquidity").push(minimumLiquidity).returnWords(1)
+	p.label("factory").push(pairFactorySlot).op(vm.SLOAD).returnWords(1)
+	p.label("token0").push(pairToken0Slot).op(vm.SLOAD).returnWords(1)
+	p.label("token1").push(pairToken1Slot).op(vm.SLOAD).returnWords(1)
+	p.label("getReserves").push(pairTimestampSlot).op(vm.SLOAD).push(pairReserve1Slot).op(vm.SLOAD).push(pairReserve0Slot).op(vm.SLOAD).returnWords(3)
+
+	// initialize is called once by the factory right after creation
+	p.label("initialize")
+	p.push(pairFactorySlot).op(vm.SLOAD, vm.CALLER, vm.EQ).require()
+	p.arg(0).push(pairToken0Slot).op(vm.SSTORE).arg(1).push(pairToken1Slot).op(vm.SSTORE).op(vm.STOP)
+
+	// mint(to) issues LP tokens for the balances above the reserves
+	p.label("mint").call("balances")
+	p.assign(pReserve0, stored(pairReserve0Slot)).assign(pReserve1, stored(pairReserve1Slot))
+	p.requireAtLeast(local(pBalance0), local(pReserve0)).requireAtLeast(local(pBalance1), local(pReserve1))
+	p.get(pReserve0).get(pBalance0).op(vm.SUB).set(pAmount0)
+	p.get(pReserve1).get(pBalance1).op(vm.SUB).set(pAmount1)
+	p.assign(pSupply, stored(pairSupplySlot))
+	p.get(pSupply).jumpi("mintProRata")
+	// The first deposit mints sqrt(amount0 * amount1) and locks MINIMUM_LIQUIDITY of it
+	p.get(pAmount1).get(pAmount0).op(vm.MUL).set(pX).call("sqrt")
+	p.push(minimumLiquidity).get(pZ).op(vm.GT).require()
+	p.push(minimumLiquidity).get(pZ).op(vm.SUB).set(pLiquidity)
+	p.assign(pTo, constant(0)).assign(pValue, constant(minimumLiquidity)).call("mintLP")
+	p.jump("minted")
+	p.label("mintProRata")
+	p.get(pReserve0).get(pSupply).get(pAmount0).op(vm.MUL, vm.DIV).set(pLiquidity)
+	p.get(pReserve1).get(pSupply).get(pAmount1).op(vm.MUL, vm.DIV).set(pY)
+	p.get(pLiquidity).get(pY).op(vm.LT).op(vm.ISZERO).jumpi("minted")
+	p.get(pY).set(pLiquidity)
+	p.label("minted")
+	p.get(pLiquidity).require()
+	p.assign(pTo, param(0)).assign(pValue, local(pLiquidity)).call("mintLP")
+	p.call("update")
+	p.get(pLiquidity).returnWords(1)
+
+	// burn(to) pays out the share of the balances of the LP tokens sent to the pair
+	p.label("burn").call("balances")
+	p.op(vm.ADDRESS).mapping(pairBalancesSlot).op(vm.SLOAD).set(pLiquidity)
+	p.assign(pSupply, stored(pairSupplySlot))
+	p.get(pSupply).get(pBalance0).get(pLiquidity).op(vm.MUL, vm.DIV).set(pAmount0)
+	p.get(pSupply).get(pBalance1).get(pLiquidity).op(vm.MUL, vm.DIV).set(pAmount1)
+	p.get(pAmount0).require().get(pAmount1).require()
+	p.get(pLiquidity).get(pSupply).op(vm.SUB).push(pairSupplySlot).op(vm.SSTORE)
+	p.push(0).op(vm.ADDRESS).mapping(pairBalancesSlot).op(vm.SSTORE)
+	p.assign(pToken, stored(pairToken0Slot)).assign(pTo, param(0)).assign(pValue, local(pAmount0)).call("safeTransfer")
+	p.assign(pToken, stored(pairToken1Slot)).assign(pValue, local(pAmount1)).call("safeTransfer")
+	p.call("balances").call("update")
+	p.get(pAmount1).get(pAmount0).returnWords(2)
+
+	// swap(amount0Out, amount1Out, to, data) pays out first and then checks the constant
+	// product of the balances, less the 0.3% fee on what came in
+	p.label("swap")
+	p.assign(pAmount0, param(0)).assign(pAmount1, param(1))
+	p.get(pAmount0).get(pAmount1).op(vm.OR).require()
+	p.assign(pReserve0, stored(pairReserve0Slot)).assign(pReserve1, stored(pairReserve1Slot))
+	p.get(pReserve0).get(pAmount0).op(vm.LT).require()
+	p.get(pReserve1).get(pAmount1).op(vm.LT).require()
+	p.assign(pTo, param(2))
+	p.push(pairToken0Slot).op(vm.SLOAD).get(pTo).op(vm.EQ).op(vm.ISZERO).require()
+	p.push(pairToken1Slot).op(vm.SLOAD).get(pTo).op(vm.EQ).op(vm.ISZERO).require()
+	// Flash swaps are not supported, so data must be empty
+	p.arg(3).push(4).op(vm.ADD, vm.CALLDATALOAD, vm.ISZERO).require()
+	p.get(pAmount0).op(vm.ISZERO).jumpi("paid0")
+	p.assign(pToken, stored(pairToken0Slot)).assign(pValue, local(pAmount0)).call("safeTransfer")
+	p.label("paid0")
+	p.get(pAmount1).op(vm.ISZERO).jumpi("paid1")
+	p.assign(pToken, stored(pairToken1Slot)).assign(pValue, local(pAmount1)).call("safeTransfer")
+	p.label("paid1")
+	p.call("balances")
+	p.amountIn(pAmount0In, pBalance0, pReserve0, pAmount0)
+	p.amountIn(pAmount1In, pBalance1, pReserve1, pAmount1)
+	p.get(pAmount0In).get(pAmount1In).op(vm.OR).require()
+	p.push(3).get(pAmount0In).op(vm.MUL).push(1000).get(pBalance0).op(vm.MUL, vm.SUB)
+	p.push(3).get(pAmount1In).op(vm.MUL).push(1000).get(pBalance1).op(vm.MUL, vm.SUB)
+	p.op(vm.MUL)
+	p.push(1000000).get(pReserve1).get(pReserve0).op(vm.MUL, vm.MUL)
+	p.op(vm.SWAP1, vm.LT, vm.ISZERO).require()
+	p.call("update").op(vm.STOP)
+
+	p.label("sync").call("balances").call("update").op(vm.STOP)
+
+	// balances sets pBalance0 and pBalance1 to the pair's token balances
+	p.label("balances")
+	p.invoke(stored(pairToken0Slot), constant(0), "balanceOf(address)", env(vm.ADDRESS)).assign(pBalance0, result(0))
+	p.invoke(stored(pairToken1Slot), constant(0), "balanceOf(address)", env(vm.ADDRESS)).assign(pBalance1, result(0))
+	p.ret()
+
+	// update makes pBalance0 and pBalance1 the reserves
+	p.label("update")
+	p.get(pBalance0).push(pairReserve0Slot).op(vm.SSTORE)
+	p.get(pBalance1).push(pairReserve1Slot).op(vm.SSTORE)
+	p.op(vm.TIMESTAMP).push(pairTimestampSlot).op(vm.SSTORE)
+	p.ret()
+
+	// safeTransfer sends pValue of pToken to pTo
+	p.label("safeTransfer")
+	p.invoke(local(pToken), constant(0), "transfer(address,uint256)", local(pTo), local(pValue)).returnedTrue()
+	p.ret()
+
+	// mintLP credits pValue LP tokens to pTo
+	p.label("mintLP")
+	p.get(pValue).push(pairSupplySlot).op(vm.SLOAD, vm.ADD).push(pairSupplySlot).op(vm.SSTORE)
+	p.get(pTo).mapping(pairBalancesSlot).op(vm.DUP1, vm.SLOAD).get(pValue).op(vm.ADD, vm.SWAP1, vm.SSTORE)
+	p.ret()
+
+	// sqrt sets pZ to the integer square root of pX with the Babylonian method of Math.sqrt
+	p.label("sqrt")
+	p.assign(pZ, constant(0))
+	p.push(3).get(pX).op(vm.GT).jumpi("sqrtLarge")
+	p.get(pX).op(vm.ISZERO).jumpi("sqrtDone")
+	p.assign(pZ, constant(1)).jump("sqrtDone")
+	p.label("sqrtLarge")
+	p.assign(pZ, local(pX))
+	p.push(1).push(2).get(pX).op(vm.DIV, vm.ADD).set(pY)
+	p.label("sqrtLoop")
+	p.get(pZ).get(pY).op(vm.LT).op(vm.ISZERO).jumpi("sqrtDone")
+	p.assign(pZ, local(pY))
+	p.push(2).get(pY).get(pY).get(pX).op(vm.DIV, vm.ADD, vm.DIV).set(pY)
+	p.jump("sqrtLoop")
+	p.label("sqrtDone")
+	p.ret()
+
+	return p.assemble()
+}
+
+// amountIn sets variable in to what came in on one side of a swap: the balance above the
+// reserve left after paying out, or zero.
+func (p *program) amountIn(in, balance, reserve, out int) *program {
+	none := p.fresh("noAmountIn")
+	p.get(out).get(reserve).op(vm.SUB).set(pX)
+	p.assign(in, constant(0))
+	p.get(pX).get(balance).op(vm.GT, vm.ISZERO).jumpi(none)
+	p.get(pX).get(balance).op(vm.SUB).set(in)
+	return p.label(none)
+}
+
+// pairInitCode is the creation code of a pair: it records the deploying factory and returns
+// pairCode.
+func pairInitCode() []byte {
+	runtime := pairCode()
+	p := newProgram()
+	p.op(vm.CALLER).push(pairFactorySlot).op(vm.SSTORE)
+	p.push(len(runtime)).op(vm.DUP1).pushLabel("runtime").push(0).op(vm.CODECOPY)
+	p.push(0).op(vm.RETURN)
+	p.embed("runtime", runtime)
+	return p.assemble()
+}
+
+// pairInitCodeHash is the hash UniswapV2Library hard-codes to derive pair addresses.
+var pairInitCodeHash = crypto.Keccak256Hash(pairInitCode())
+
+// PairAddress is the address the factory creates the tokenA/tokenB pair at.
+func PairAddress(tokenA, tokenB common.Address) common.Address {
+	token0, token1 := tokenA, tokenB
+	if token0.Cmp(token1) > 0 {
+		token0, token1 = token1, token0
+	}
+	salt := crypto.Keccak256(token0.Bytes(), token1.Bytes())
+	return crypto.CreateAddress2(FactoryAddress, common.BytesToHash(salt), pairInitCodeHash.Bytes())
+}
+
+// Variables of factoryCode.
+const (
+	fToken0 = iota
+	fToken1
+	fPair
+	fCount
+)
+
+// factoryCode is UniswapV2Factory without the protocol fee settings.
+func factoryCode() []byte {
+	initCode := pairInitCode()
+	p := newProgram()
+	p.dispatch(map[string]string{
+		"getPair(address,address)":    "getPair",
+		"allPairs(uint256)":           "allPairs",
+		"allPairsLength()":            "allPairsLength",
+		"createPair(address,address)": "createPair",
+	}, "")
+
+	p.label("getPair").arg(1).arg(0).nestedMapping(factoryPairsSlot).op(vm.SLOAD).returnWords(1)
+	p.label("allPairsLength").push(factoryAllPairsSlot).op(vm.SLOAD).returnWords(1)
+	p.label("allPairs")
+	p.push(factoryAllPairsSlot).op(vm.SLOAD).arg(0).op(vm.LT).require()
+	p.arg(0).push(factoryAllPairsSlot).elementSlot().op(vm.SLOAD).returnWords(1)
+
+	p.label("createPair")
+	p.arg(0).arg(1).op(vm.EQ, vm.ISZERO).require()
+	p.arg(1).arg(0).op(vm.LT).jumpi("ordered")
+	p.assign(fToken0, param(1)).assign(fToken1, param(0)).jump("sorted")
+	p.label("ordered")
+	p.assign(fToken0, param(0)).assign(fToken1, param(1))
+	p.label("sorted")
+	p.get(fToken0).require()
+	p.get(fToken1).get(fToken0).nestedMapping(factoryPairsSlot).op(vm.SLOAD, vm.ISZERO).require()
+
+	// CREATE2 with salt keccak256(abi.encodePacked(token0, token1))
+	p.pairSalt(fToken0, fToken1)
+	p.push(len(initCode)).op(vm.DUP1).pushLabel("pairInitCode").push(initBuf).op(vm.CODECOPY)
+	p.push(initBuf).push(0).op(vm.CREATE2)
+	p.op(vm.DUP1).require().set(fPair)
+	p.invoke(local(fPair), constant(0), "initialize(address,address)", local(fToken0), local(fToken1))
+
+	p.get(fPair).get(fToken1).get(fToken0).nestedMapping(factoryPairsSlot).op(vm.SSTORE)
+	p.get(fPair).get(fToken0).get(fToken1).nestedMapping(factoryPairsSlot).op(vm.SSTORE)
+	p.assign(fCount, stored(factoryAllPairsSlot))
+	p.get(fPair).get(fCount).push(factoryAllPairsSlot).elementSlot().op(vm.SSTORE)
+	p.push(1).get(fCount).op(vm.ADD).push(factoryAllPairsSlot).op(vm.SSTORE)
+	p.get(fPair).returnWords(1)
+
+	p.embed("pairInitCode", initCode)
+	return p.assemble()
+}
+
+// pairSalt pushes keccak256(abi.encodePacked(token0, token1)) of the addresses in the variables.
+// token1 is written first so that token0's word only overwrites its zero padding.
+func (p *program) pairSalt(token0, token1 int) *program {
+	p.get(token1).push(20).op(vm.MSTORE).get(token0).push(0).op(vm.MSTORE)
+	return p.push(40).push(12).op(vm.KECCAK256)
+}
+
+// elementSlot replaces the array slot (top) and index (below it) with the slot of the element.
+func (p *program) elementSlot() *program {
+	return p.push(0).op(vm.MSTORE).push(32).push(0).op(vm.KECCAK256, vm.ADD)
+}
+
+// Variables of routerCode.
+const (
+	rPath = iota
+	rN
+	rI
+	rTo
+	rA
+	rB
+	rToken0
+	rToken1
+	rPair
+	rHopPair
+	rReserveA
+	rReserveB
+	rAmount
+	rAmountIn
+	rReserveIn
+	rReserveOut
+	rAmountOut
+	rX
+	rInput
+	rOutput
+	rSwapTo
+	rAmount0Out
+	rAmount1Out
+	rDesiredA
+	rDesiredB
+	rMinA
+	rMinB
+	rAmountA
+	rAmountB
+	rLiquidity
+	rToken
+	rBalance
+)
+
+// pathToken is the token at index of the calldata path whose length word is at rPath.
+func pathToken(index operand) operand {
+	return func(p *program) {
+		index(p)
+		p.push(32).op(vm.MUL).get(rPath).op(vm.ADD).push(32).op(vm.ADD, vm.CALLDATALOAD)
+	}
+}
+
+// hop is rI plus k.
+func hop(k int) operand {
+	return func(p *program) { p.push(k).get(rI).op(vm.ADD) }
+}
+
+// lastHop is rN minus k.
+func lastHop(k int) operand {
+	return func(p *program) { p.push(k).get(rN).op(vm.SUB) }
+}
+
+// amountAt is amounts[index].
+func amountAt(index operand) operand {
+	return func(p *program) {
+		index(p)
+		p.push(32).op(vm.MUL).push(amountsBuf+32).op(vm.ADD, vm.MLOAD)
+	}
+}
+
+// route points rPath at the address[] of argument i and sets rN to its length, at least two.
+func (p *program) route(i int) *program {
+	p.arg(i).push(4).op(vm.ADD).set(rPath)
+	p.get(rPath).op(vm.CALLDATALOAD).set(rN)
+	return p.push(2).get(rN).op(vm.LT, vm.ISZERO).require()
+}
+
+// returnAmounts returns the amounts[] getAmountsOut filled in.
+func (p *program) returnAmounts() *program {
+	p.push(32).push(amountsBuf - 32).op(vm.MSTORE)
+	return p.get(rN).push(32).op(vm.MUL).push(64).op(vm.ADD).push(amountsBuf - 32).op(vm.RETURN)
+}
+
+// routerCode is UniswapV2Router02 for factory and weth, with the exact-input swaps and their
+// fee-on-transfer variants, adding liquidity and removing it against ETH with or without
+// transfer fees.
+func routerCode(factory, weth common.Address) []byte {
+	p := newProgram()
+	p.dispatch(map[string]string{
+		"factory()":                             "factory",
+		"WETH()":                                "weth",
+		"getAmountOut(uint256,uint256,uint256)": "getAmountOut",
+		"getAmountsOut(uint256,address[])":      "getAmountsOut",
+		"swapExactETHForTokens(uint256,address[],address,uint256)":                                         "swapExactETHForTokens",
+		"swapExactTokensForETH(uint256,uint256,address[],address,uint256)":                                 "swapExactTokensForETH",
+		"swapExactTokensForTokens(uint256,uint256,address[],address,uint256)":                              "swapExactTokensForTokens",
+		"swapExactETHForTokensSupportingFeeOnTransferTokens(uint256,address[],address,uint256)":            "swapExactETHForTokensSupportingFee",
+		"swapExactTokensForETHSupportingFeeOnTransferTokens(uint256,uint256,address[],address,uint256)":    "swapExactTokensForETHSupportingFee",
+		"swapExactTokensForTokensSupportingFeeOnTransferTokens(uint256,uint256,address[],address,uint256)": "swapExactTokensForTokensSupportingFee",
+		"addLiquidity(address,address,uint256,uint256,uint256,uint256,address,uint256)":                    "addLiquidity",
+		"addLiquidityETH(address,uint256,uint256,uint256,address,uint256)":                                 "addLiquidityETH",
+		"removeLiquidityETH(address,uint256,uint256,uint256,address,uint256)":                              "removeLiquidityETH",
+		"removeLiquidityETHSupportingFeeOnTransferTokens(address,uint256,uint256,uint256,address,uint256)": "removeLiquidityETHSupportingFee",
+	}, "receive")
+
+	// Only WETH may send ETH without calldata, when it is unwrapped
+	p.label("receive").op(vm.CALLER).push(weth).op(vm.EQ).require().op(vm.STOP)
+
+	p.label("factory").push(factory).returnWords(1)
+	p.label("weth").push(weth).returnWords(1)
+
+	p.label("getAmountOut")
+	p.assign(rAmountIn, param(0)).assign(rReserveIn, param(1)).assign(rReserveOut, param(2))
+	p.call("amountOut").get(rAmountOut).returnWords(1)
+
+	p.label("getAmountsOut").route(1).assign(rAmount, param(0)).call("amountsOut").returnAmounts()
+
+	p.label("swapExactETHForTokens").requireDeadline(3).route(1)
+	p.pathToken(0).push(weth).op(vm.EQ).require()
+	p.assign(rAmount, env(vm.CALLVALUE)).call("amountsOut")
+	p.requireAtLeast(amountAt(lastHop(1)), param(0))
+	p.invoke(constant(weth), amountAt(constant(0)), "deposit()")
+	p.firstPair()
+	p.invoke(constant(weth), constant(0), "transfer(address,uint256)", local(rPair), amountAt(constant(0))).returnedTrue()
+	p.assign(rTo, param(2)).call("swap").returnAmounts()
+
+	p.label("swapExactTokensForETH").requireDeadline(4).route(2)
+	p.pathToken(-1).push(weth).op(vm.EQ).require()
+	p.assign(rAmount, param(0)).call("amountsOut")
+	p.requireAtLeast(amountAt(lastHop(1)), param(1))
+	p.firstPair()
+	p.invoke(pathToken(constant(0)), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), amountAt(constant(0))).returnedTrue()
+	p.assign(rTo, env(vm.ADDRESS)).call("swap")
+	p.invoke(constant(weth), constant(0), "withdraw(uint256)", amountAt(lastHop(1)))
+	p.send(param(3), amountAt(lastHop(1))).returnAmounts()
+
+	p.label("swapExactTokensForTokens").requireDeadline(4).route(2)
+	p.assign(rAmount, param(0)).call("amountsOut")
+	p.requireAtLeast(amountAt(lastHop(1)), param(1))
+	p.firstPair()
+	p.invoke(pathToken(constant(0)), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), amountAt(constant(0))).returnedTrue()
+	p.assign(rTo, param(3)).call("swap").returnAmounts()
+
+	// The fee-on-transfer variants check what actually arrived instead of the quoted amounts
+	p.label("swapExactETHForTokensSupportingFee").requireDeadline(3).route(1)
+	p.pathToken(0).push(weth).op(vm.EQ).require()
+	p.invoke(constant(weth), env(vm.CALLVALUE), "deposit()")
+	p.firstPair()
+	p.invoke(constant(weth), constant(0), "transfer(address,uint256)", local(rPair), env(vm.CALLVALUE)).returnedTrue()
+	p.assign(rToken, pathToken(lastHop(1)))
+	p.invoke(local(rToken), constant(0), "balanceOf(address)", param(2)).assign(rBalance, result(0))
+	p.assign(rTo, param(2)).call("swapSupportingFee")
+	p.invoke(local(rToken), constant(0), "balanceOf(address)", param(2))
+	p.get(rBalance).push(callBuf).op(vm.MLOAD, vm.SUB).set(rAmountOut)
+	p.requireAtLeast(local(rAmountOut), param(0)).op(vm.STOP)
+
+	p.label("swapExactTokensForTokensSupportingFee").requireDeadline(4).route(2)
+	p.firstPair()
+	p.invoke(pathToken(constant(0)), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), param(0)).returnedTrue()
+	p.assign(rToken, pathToken(lastHop(1)))
+	p.invoke(local(rToken), constant(0), "balanceOf(address)", param(3)).assign(rBalance, result(0))
+	p.assign(rTo, param(3)).call("swapSupportingFee")
+	p.invoke(local(rToken), constant(0), "balanceOf(address)", param(3))
+	p.get(rBalance).push(callBuf).op(vm.MLOAD, vm.SUB).set(rAmountOut)
+	p.requireAtLeast(local(rAmountOut), param(1)).op(vm.STOP)
+
+	p.label("swapExactTokensForETHSupportingFee").requireDeadline(4).route(2)
+	p.pathToken(-1).push(weth).op(vm.EQ).require()
+	p.firstPair()
+	p.invoke(pathToken(constant(0)), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), param(0)).returnedTrue()
+	p.assign(rTo, env(vm.ADDRESS)).call("swapSupportingFee")
+	p.invoke(constant(weth), constant(0), "balanceOf(address)", env(vm.ADDRESS)).assign(rAmountOut, result(0))
+	p.requireAtLeast(local(rAmountOut), param(1))
+	p.invoke(constant(weth), constant(0), "withdraw(uint256)", local(rAmountOut))
+	p.send(param(3), local(rAmountOut)).op(vm.STOP)
+
+	p.label("addLiquidity").requireDeadline(7)
+	p.assign(rA, param(0)).assign(rB, param(1))
+	p.assign(rDesiredA, param(2)).assign(rDesiredB, param(3)).assign(rMinA, param(4)).assign(rMinB, param(5))
+	p.call("liquidityAmounts").call("pairFor")
+	p.invoke(local(rA), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), local(rAmountA)).returnedTrue()
+	p.invoke(local(rB), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), local(rAmountB)).returnedTrue()
+	p.invoke(local(rPair), constant(0), "mint(address)", param(6)).assign(rLiquidity, result(0))
+	p.get(rLiquidity).get(rAmountB).get(rAmountA).returnWords(3)
+
+	p.label("addLiquidityETH").requireDeadline(5)
+	p.assign(rA, param(0)).assign(rB, constant(weth))
+	p.assign(rDesiredA, param(1)).assign(rDesiredB, env(vm.CALLVALUE)).assign(rMinA, param(2)).assign(rMinB, param(3))
+	p.call("liquidityAmounts").call("pairFor")
+	p.invoke(local(rA), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), local(rAmountA)).returnedTrue()
+	p.invoke(constant(weth), local(rAmountB), "deposit()")
+	p.invoke(constant(weth), constant(0), "transfer(address,uint256)", local(rPair), local(rAmountB)).returnedTrue()
+	p.invoke(local(rPair), constant(0), "mint(address)", param(4)).assign(rLiquidity, result(0))
+	// Refund the ETH the pool ratio left over
+	p.get(rAmountB).op(vm.CALLVALUE, vm.GT, vm.ISZERO).jumpi("refunded")
+	p.send(env(vm.CALLER), func(p *program) { p.get(rAmountB).op(vm.CALLVALUE, vm.SUB) })
+	p.label("refunded")
+	p.get(rLiquidity).get(rAmountB).get(rAmountA).returnWords(3)
+
+	p.label("removeLiquidityETH").requireDeadline(5).call("removeLiquidity")
+	p.invoke(local(rA), constant(0), "transfer(address,uint256)", param(4), local(rAmountA)).returnedTrue()
+	p.invoke(constant(weth), constant(0), "withdraw(uint256)", local(rAmountB))
+	p.send(param(4), local(rAmountB))
+	p.get(rAmountB).get(rAmountA).returnWords(2)
+
+	// The fee-on-transfer variant forwards whatever reached the router rather than the amount burned
+	p.label("removeLiquidityETHSupportingFee").requireDeadline(5).call("removeLiquidity")
+	p.invoke(local(rA), constant(0), "balanceOf(address)", env(vm.ADDRESS))
+	p.invoke(local(rA), constant(0), "transfer(address,uint256)", param(4), result(0)).returnedTrue()
+	p.invoke(constant(weth), constant(0), "withdraw(uint256)", local(rAmountB))
+	p.send(param(4), local(rAmountB))
+	p.get(rAmountB).returnWords(1)
+
+	// removeLiquidity burns argument 1 of the caller's token/WETH liquidity to the router and sets
+	// rAmountA and rAmountB to the token and WETH paid out, which must cover arguments 2 and 3
+	p.label("removeLiquidity")
+	p.assign(rA, param(0)).assign(rB, constant(weth)).call("pairFor")
+	p.invoke(local(rPair), constant(0), "transferFrom(address,address,uint256)", env(vm.CALLER), local(rPair), param(1)).returnedTrue()
+	p.invoke(local(rPair), constant(0), "burn(address)", env(vm.ADDRESS))
+	p.get(rA).get(rToken0).op(vm.EQ).jumpi("burnedInOrder")
+	p.assign(rAmountA, result(1)).assign(rAmountB, result(0)).jump("burnedSorted")
+	p.label("burnedInOrder")
+	p.assign(rAmountA, result(0)).assign(rAmountB, result(1))
+	p.label("burnedSorted")
+	p.requireAtLeast(local(rAmountA), param(2)).requireAtLeast(local(rAmountB), param(3))
+	p.ret()
+
+	// sortTokens sets rToken0 and rToken1 to rA and rB in address order
+	p.label("sortTokens")
+	p.get(rA).get(rB).op(vm.EQ, vm.ISZERO).require()
+	p.get(rB).get(rA).op(vm.LT).jumpi("sortedInOrder")
+	p.assign(rToken0, local(rB)).assign(rToken1, local(rA)).jump("sortedDone")
+	p.label("sortedInOrder")
+	p.assign(rToken0, local(rA)).assign(rToken1, local(rB))
+	p.label("sortedDone")
+	p.get(rToken0).require()
+	p.ret()
+
+	// pairFor sets rPair to the CREATE2 address of the rA/rB pair, without any call
+	p.label("pairFor").call("sortTokens")
+	p.pairSalt(rToken0, rToken1).push(hashBuf + 32).op(vm.MSTORE)
+	p.push(new(big.Int).Or(new(big.Int).Lsh(big.NewInt(0xff), 160), factory.Big())).push(hashBuf).op(vm.MSTORE)
+	p.push(pairInitCodeHash).push(hashBuf + 64).op(vm.MSTORE)
+	p.push(85).push(hashBuf + 11).op(vm.KECCAK256)
+	p.push(common.MaxAddress).op(vm.AND).set(rPair)
+	p.ret()
+
+	// reserves sets rReserveA and rReserveB to the reserves of the rA/rB pair in that order
+	p.label("reserves").call("pairFor")
+	p.invoke(local(rPair), constant(0), "getReserves()")
+	p.get(rA).get(rToken0).op(vm.EQ).jumpi("reservesInOrder")
+	p.assign(rReserveA, result(1)).assign(rReserveB, result(0)).jump("reservesDone")
+	p.label("reservesInOrder")
+	p.assign(rReserveA, result(0)).assign(rReserveB, result(1))
+	p.label("reservesDone")
+	p.ret()
+
+	// amountOut sets rAmountOut to UniswapV2Library.getAmountOut(rAmountIn, rReserveIn, rReserveOut)
+	p.label("amountOut")
+	p.get(rAmountIn).require().get(rReserveIn).require().get(rReserveOut).require()
+	p.push(997).get(rAmountIn).op(vm.MUL).set(rX)
+	p.get(rX).push(1000).get(rReserveIn).op(vm.MUL, vm.ADD)
+	p.get(rReserveOut).get(rX).op(vm.MUL, vm.DIV).set(rAmountOut)
+	p.ret()
+
+	// amountsOut fills amounts[] for rAmount along the path at rPath
+	p.label("amountsOut")
+	p.get(rN).push(amountsBuf).op(vm.MSTORE).get(rAmount).push(amountsBuf + 32).op(vm.MSTORE)
+	p.assign(rI, constant(0))
+	p.label("amountsLoop")
+	p.push(1).get(rN).op(vm.SUB).get(rI).op(vm.LT, vm.ISZERO).jumpi("amountsDone")
+	p.assign(rA, pathToken(hop(0))).assign(rB, pathToken(hop(1))).call("reserves")
+	p.assign(rAmountIn, amountAt(hop(0))).assign(rReserveIn, local(rReserveA)).assign(rReserveOut, local(rReserveB))
+	p.call("amountOut")
+	p.get(rAmountOut).push(32).get(rI).op(vm.MUL).push(amountsBuf+64).op(vm.ADD, vm.MSTORE)
+	p.assign(rI, hop(1)).jump("amountsLoop")
+	p.label("amountsDone")
+	p.ret()
+
+	// swap runs the hops of rPath with the amounts[] from amountsOut, paying each output to the
+	// next pair and the last one to rTo
+	p.label("swap").assign(rI, constant(0))
+	p.label("swapLoop")
+	p.push(1).get(rN).op(vm.SUB).get(rI).op(vm.LT, vm.ISZERO).jumpi("swapDone")
+	p.assign(rInput, pathToken(hop(0))).assign(rOutput, pathToken(hop(1)))
+	p.assign(rA, local(rInput)).assign(rB, local(rOutput)).call("pairFor").assign(rHopPair, local(rPair))
+	p.assign(rAmountOut, amountAt(hop(1)))
+	p.swapHop("swap")
+	p.assign(rI, hop(1)).jump("swapLoop")
+	p.label("swapDone")
+	p.ret()
+
+	// swapSupportingFee runs the hops of rPath, each selling what actually reached its pair
+	p.label("swapSupportingFee").assign(rI, constant(0))
+	p.label("feeSwapLoop")
+	p.push(1).get(rN).op(vm.SUB).get(rI).op(vm.LT, vm.ISZERO).jumpi("feeSwapDone")
+	p.assign(rInput, pathToken(hop(0))).assign(rOutput, pathToken(hop(1)))
+	p.assign(rA, local(rInput)).assign(rB, local(rOutput)).call("reserves").assign(rHopPair, local(rPair))
+	p.invoke(local(rInput), constant(0), "balanceOf(address)", local(rHopPair))
+	p.get(rReserveA).push(callBuf).op(vm.MLOAD, vm.SUB).set(rAmountIn)
+	p.assign(rReserveIn, local(rReserveA)).assign(rReserveOut, local(rReserveB)).call("amountOut")
+	p.swapHop("feeSwap")
+	p.assign(rI, hop(1)).jump("feeSwapLoop")
+	p.label("feeSwapDone")
+	p.ret()
+
+	// liquidityAmounts is UniswapV2Router02._addLiquidity: it creates the rA/rB pair if needed
+	// and sets rAmountA and rAmountB to the desired amounts at the pool ratio
+	p.label("liquidityAmounts")
+	p.invoke(constant(factory), constant(0), "getPair(address,address)", local(rA), local(rB))
+	p.push(callBuf).op(vm.MLOAD).jumpi("pairExists")
+	p.invoke(constant(factory), constant(0), "createPair(address,address)", local(rA), local(rB))
+	p.label("pairExists")
+	p.call("reserves")
+	p.get(rReserveA).get(rReserveB).op(vm.OR).jumpi("quoteAmounts")
+	p.assign(rAmountA, local(rDesiredA)).assign(rAmountB, local(rDesiredB)).jump("amountsChosen")
+	p.label("quoteAmounts")
+	p.get(rReserveA).get(rReserveB).get(rDesiredA).op(vm.MUL, vm.DIV).set(rX)
+	p.get(rDesiredB).get(rX).op(vm.GT).jumpi("quoteA")
+	p.requireAtLeast(local(rX), local(rMinB))
+	p.assign(rAmountA, local(rDesiredA)).assign(rAmountB, local(rX)).jump("amountsChosen")
+	p.label("quoteA")
+	p.get(rReserveB).get(rReserveA).get(rDesiredB).op(vm.MUL, vm.DIV).set(rX)
+	p.requireAtLeast(local(rDesiredA), local(rX)).requireAtLeast(local(rX), local(rMinA))
+	p.assign(rAmountA, local(rX)).assign(rAmountB, local(rDesiredB))
+	p.label("amountsChosen")
+	p.ret()
+
+	return p.assemble()
+}
+
+// pathToken pushes the token at index of the path, counting from the end when negative.
+func (p *program) pathToken(index int) *program {
+	if index < 0 {
+		pathToken(lastHop(-index))(p)
+	} else {
+		pathToken(constant(index))(p)
+	}
+	return p
+}
+
+// firstPair sets rPair to the pair of the first hop of the path.
+func (p *program) firstPair() *program {
+	return p.assign(rA, pathToken(constant(0))).assign(rB, pathToken(constant(1))).call("pairFor")
+}
+
+// swapHop calls swap on rHopPair for rAmountOut of rOutput, sent to the pair of the next hop or
+// to rTo after the last one. Its labels are prefixed with prefix.
+func (p *program) swapHop(prefix string) *program {
+	inOrder, recipient := prefix+"InOrder", prefix+"LastHop"
+	p.assign(rAmount0Out, constant(0)).assign(rAmount1Out, local(rAmountOut))
+	p.get(rInput).get(rToken0).op(vm.EQ).jumpi(inOrder)
+	p.assign(rAmount0Out, local(rAmountOut)).assign(rAmount1Out, constant(0))
+	p.label(inOrder)
+	p.assign(rSwapTo, local(rTo))
+	p.push(2).get(rN).op(vm.SUB).get(rI).op(vm.LT, vm.ISZERO).jumpi(recipient)
+	p.assign(rA, pathToken(hop(1))).assign(rB, pathToken(hop(2))).call("pairFor").assign(rSwapTo, local(rPair))
+	p.label(recipient)
+	return p.invoke(local(rHopPair), constant(0), "swap(uint256,uint256,address,bytes)",
+		local(rAmount0Out), local(rAmount1Out), local(rSwapTo), constant(0x80), constant(0))
+}
+
+// mappingKey is the storage slot of key in the mapping at slot.
+func mappingKey(key common.Address, slot int64) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(key.Bytes(), 32), common.LeftPadBytes(big.NewInt(slot).Bytes(), 32))
+}
@@ -0,0 +1,350 @@
+package testchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/nimazeighami/flash-liquswap-sync/internal/flashbot"
+)
+
+// Relay is a Flashbots relay backed by a Chain. Every request must carry a valid
+// X-Flashbots-Signature. eth_callBundle simulates on top of the latest block, and eth_sendBundle
+// includes the bundle in the next block right away unless a transaction outside
+// revertingTxHashes fails, in which case the bundle is dropped like a builder would. LoseNext
+// makes it lose bundles to other blocks instead.
+type Relay struct {
+	URL string
+
+	chain *Chain
+
+	mu        sync.Mutex
+	calls     map[string]int
+	signers   map[common.Address]bool
+	lose      int
+	competing []*types.Transaction
+}
+
+// NewRelay serves a relay for chain until t completes.
+func NewRelay(t testing.TB, chain *Chain) *Relay {
+	t.Helper()
+
+	r := &Relay{chain: chain, calls: make(map[string]int), signers: make(map[common.Address]bool)}
+	server := httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(server.Close)
+	r.URL = server.URL
+	return r
+}
+
+// Calls returns how many authenticated requests of method the relay answered.
+func (r *Relay) Calls(method string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[method]
+}
+
+// SignedBy reports whether a request was signed by signer.
+func (r *Relay) SignedBy(signer common.Address) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.signers[signer]
+}
+
+// LoseNext accepts the next n bundles without including them: each one's target block is mined
+// without it, the first holding competing, e.g. a trade that moves the pool the bundle quoted.
+func (r *Relay) LoseNext(n int, competing ...*types.Transaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lose, r.competing = n, competing
+}
+
+type rpcRequest struct {
+	ID     int               `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (r *Relay) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, 0, nil, &rpcError{Code: -32700, Message: err.Error()})
+		return
+	}
+
+	signer, err := verifySignature(body, req.Header.Get("X-Flashbots-Signature"))
+	if err != nil {
+		writeResponse(w, http.StatusForbidden, 0, nil, &rpcError{Code: -32600, Message: err.Error()})
+		return
+	}
+
+	var request rpcRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeResponse(w, http.StatusBadRequest, 0, nil, &rpcError{Code: -32700, Message: err.Error()})
+		return
+	}
+
+	r.mu.Lock()
+	r.calls[request.Method]++
+	r.signers[signer] = true
+	r.mu.Unlock()
+
+	result, err := r.handle(req.Context(), request)
+	if err != nil {
+		writeResponse(w, http.StatusOK, request.ID, nil, &rpcError{Code: -32000, Message: err.Error()})
+		return
+	}
+	writeResponse(w, http.StatusOK, request.ID, result, nil)
+}
+
+func writeResponse(w http.ResponseWriter, status, id int, result interface{}, rpcErr *rpcError) {
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// verifySignature checks header against body the way the Flashbots relay does and returns the
+// signing address.
+func verifySignature(body []byte, header string) (common.Address, error) {
+	addrHex, sigHex, ok := strings.Cut(header, ":")
+	if !ok || !common.IsHexAddress(addrHex) {
+		return common.Address{}, fmt.Errorf("missing or malformed X-Flashbots-Signature")
+	}
+	sig, err := hexutil.Decode(sigHex)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("malformed signature")
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+
+	hash := accounts.TextHash([]byte(hexutil.Encode(crypto.Keccak256(body))))
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	if signer := crypto.PubkeyToAddress(*pub); signer != common.HexToAddress(addrHex) {
+		return common.Address{}, fmt.Errorf("signature does not match %s", addrHex)
+	}
+	return common.HexToAddress(addrHex), nil
+}
+
+func (r *Relay) handle(ctx context.Context, request rpcRequest) (interface{}, error) {
+	switch request.Method {
+	case "eth_callBundle", "eth_sendBundle":
+		if len(request.Params) != 1 {
+			return nil, fmt.Errorf("expected one bundle parameter")
+		}
+		var bundle flashbot.Bundle
+		if err := json.Unmarshal(request.Params[0], &bundle); err != nil {
+			return nil, fmt.Errorf("invalid bundle: %v", err)
+		}
+		txs, err := decodeTransactions(bundle.Txs)
+		if err != nil {
+			return nil, err
+		}
+		sim, err := r.simulate(ctx, txs)
+		if err != nil {
+			return nil, err
+		}
+		if request.Method == "eth_callBundle" {
+			return sim, nil
+		}
+		return r.include(ctx, bundle, txs, sim)
+	case "eth_cancelBundle":
+		return nil, nil
+	case "flashbots_getBundleStatsV2":
+		return map[string]interface{}{"isSimulated": true, "isHighPriority": true}, nil
+	case "flashbots_getUserStatsV2":
+		return map[string]interface{}{
+			"isHighPriority":           true,
+			"allTimeValidatorPayments": "0",
+			"allTimeGasSimulated":      "0",
+			"last7dValidatorPayments":  "0",
+			"last7dGasSimulated":       "0",
+			"last1dValidatorPayments":  "0",
+			"last1dGasSimulated":       "0",
+		}, nil
+	default:
+		return nil, fmt.Errorf("method %s not supported", request.Method)
+	}
+}
+
+func decodeTransactions(encoded []string) ([]*types.Transaction, error) {
+	txs := make([]*types.Transaction, len(encoded))
+	for i, raw := range encoded {
+		data, err := hexutil.Decode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		txs[i] = new(types.Transaction)
+		if err := txs[i].UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+	}
+	return txs, nil
+}
+
+// simResult mirrors one entry of the eth_callBundle results.
+type simResult struct {
+	CoinbaseDiff      string `json:"coinbaseDiff"`
+	EthSentToCoinbase string `json:"ethSentToCoinbase"`
+	FromAddress       string `json:"fromAddress"`
+	GasFees           string `json:"gasFees"`
+	GasPrice          string `json:"gasPrice"`
+	GasUsed           string `json:"gasUsed"`
+	ToAddress         string `json:"toAddress"`
+	TxHash            string `json:"txHash"`
+	Value             string `json:"value"`
+	Error             string `json:"error,omitempty"`
+	Revert            string `json:"revert,omitempty"`
+}
+
+// simResponse mirrors the eth_callBundle result.
+type simResponse struct {
+	BundleGasPrice    string      `json:"bundleGasPrice"`
+	BundleHash        string      `json:"bundleHash"`
+	CoinbaseDiff      string      `json:"coinbaseDiff"`
+	EthSentToCoinbase string      `json:"ethSentToCoinbase"`
+	GasFees           string      `json:"gasFees"`
+	Results           []simResult `json:"results"`
+	StateBlockNumber  uint64      `json:"stateBlockNumber"`
+	TotalGasUsed      uint64      `json:"totalGasUsed"`
+}
+
+// simulate executes txs in order on top of the latest block through eth_simulateV1.
+func (r *Relay) simulate(ctx context.Context, txs []*types.Transaction) (*simResponse, error) {
+	header, err := r.chain.Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %v", err)
+	}
+	signer := types.LatestSignerForChainID(r.chain.ChainID)
+
+	calls := make([]map[string]interface{}, len(txs))
+	senders := make([]common.Address, len(txs))
+	for i, tx := range txs {
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature on transaction %d: %v", i, err)
+		}
+		senders[i] = from
+		calls[i] = map[string]interface{}{
+			"from":  from,
+			"to":    tx.To(),
+			"gas":   hexutil.Uint64(tx.Gas()),
+			"value": (*hexutil.Big)(tx.Value()),
+			"nonce": hexutil.Uint64(tx.Nonce()),
+			"input": hexutil.Bytes(tx.Data()),
+		}
+	}
+
+	var blocks []struct {
+		Calls []struct {
+			ReturnData hexutil.Bytes  `json:"returnData"`
+			GasUsed    hexutil.Uint64 `json:"gasUsed"`
+			Status     hexutil.Uint64 `json:"status"`
+			Error      *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"calls"`
+	}
+	opts := map[string]interface{}{"blockStateCalls": []interface{}{map[string]interface{}{"calls": calls}}}
+	if err := r.chain.RPC.CallContext(ctx, &blocks, "eth_simulateV1", opts, "latest"); err != nil {
+		return nil, fmt.Errorf("eth_simulateV1 failed: %v", err)
+	}
+	if len(blocks) != 1 || len(blocks[0].Calls) != len(txs) {
+		return nil, fmt.Errorf("eth_simulateV1 returned an unexpected shape")
+	}
+
+	response := &simResponse{StateBlockNumber: header.Number.Uint64(), EthSentToCoinbase: "0"}
+	totalFees, totalTips := new(big.Int), new(big.Int)
+	for i, call := range blocks[0].Calls {
+		tx := txs[i]
+		tip, _ := tx.EffectiveGasTip(header.BaseFee)
+		gasPrice := new(big.Int).Add(header.BaseFee, tip)
+		gasUsed := new(big.Int).SetUint64(uint64(call.GasUsed))
+		fees := new(big.Int).Mul(gasUsed, gasPrice)
+		tips := new(big.Int).Mul(gasUsed, tip)
+
+		result := simResult{
+			CoinbaseDiff:      tips.String(),
+			EthSentToCoinbase: "0",
+			FromAddress:       senders[i].Hex(),
+			GasFees:           fees.String(),
+			GasPrice:          gasPrice.String(),
+			GasUsed:           gasUsed.String(),
+			TxHash:            tx.Hash().Hex(),
+			Value:             hexutil.Encode(call.ReturnData),
+		}
+		if tx.To() != nil {
+			result.ToAddress = tx.To().Hex()
+		}
+		if uint64(call.Status) != types.ReceiptStatusSuccessful {
+			result.Error = "execution reverted"
+			if call.Error != nil {
+				result.Revert = call.Error.Message
+			}
+		}
+		response.Results = append(response.Results, result)
+
+		response.TotalGasUsed += uint64(call.GasUsed)
+		totalFees.Add(totalFees, fees)
+		totalTips.Add(totalTips, tips)
+	}
+	response.GasFees = totalFees.String()
+	response.CoinbaseDiff = totalTips.String()
+	response.BundleGasPrice = "0"
+	if response.TotalGasUsed > 0 {
+		response.BundleGasPrice = new(big.Int).Div(totalFees, new(big.Int).SetUint64(response.TotalGasUsed)).String()
+	}
+	return response, nil
+}
+
+// include mines txs into the next block unless a transaction that may not revert failed in sim,
+// or mines the next block without them while bundles are being lost.
+func (r *Relay) include(ctx context.Context, bundle flashbot.Bundle, txs []*types.Transaction, sim *simResponse) (interface{}, error) {
+	bundleHash := crypto.Keccak256Hash([]byte(strings.Join(bundle.Txs, ""))).Hex()
+	for _, result := range sim.Results {
+		if result.Error != "" && !bundle.CanRevert(result.TxHash) {
+			return map[string]string{"bundleHash": bundleHash}, nil
+		}
+	}
+
+	r.mu.Lock()
+	if r.lose > 0 {
+		r.lose--
+		txs, r.competing = r.competing, nil
+	}
+	r.mu.Unlock()
+
+	for i, tx := range txs {
+		if err := r.chain.Client.SendTransaction(ctx, tx); err != nil {
+			return nil, fmt.Errorf("failed to include transaction %d: %v", i, err)
+		}
+	}
+	r.chain.Backend.Commit()
+	return map[string]string{"bundleHash": bundleHash}, nil
+}